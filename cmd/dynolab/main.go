@@ -0,0 +1,44 @@
+// Command dynolab runs a command line as a dyno.
+//
+// Usage:
+//
+//	dynolab run [flags] -- command [args...]
+//
+// The dyno is configured through DYNOLAB_* environment variables, which are
+// removed from the environment passed to the dyno process.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dynolab: ")
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch cmd, args := os.Args[1], os.Args[2:]; cmd {
+	case "run":
+		os.Exit(runCmd(args))
+	case "help", "-h", "-help", "--help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "dynolab: unknown command %q\n", cmd)
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage: dynolab <command> [arguments]
+
+commands:
+	run	run a command line as a dyno
+`)
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/joeshaw/envdecode"
+
+	"github.com/heroku/dynolab/exec"
+	"github.com/heroku/dynolab/logging"
+	"github.com/heroku/dynolab/networking"
+	"github.com/heroku/dynolab/seccomp"
+	"github.com/heroku/dynolab/spec"
+	"github.com/heroku/dynolab/supervisor"
+)
+
+// runConfig is the dyno configuration read from the environment. The
+// variables are removed from the environment of the dyno process.
+type runConfig struct {
+	LogdrainURL string `env:"DYNOLAB_LOGDRAIN_URL"`
+	AppName     string `env:"DYNOLAB_APP_NAME"`
+	AppID       string `env:"DYNOLAB_APP_ID"`
+	ProcessID   string `env:"DYNOLAB_PROCESS_ID,default=run.1"`
+
+	LogErrorPolicy      string `env:"DYNOLAB_LOG_ERROR_POLICY,default=warn"`
+	LogFailureThreshold int    `env:"DYNOLAB_LOG_FAILURE_THRESHOLD"`
+	LogStructured       bool   `env:"DYNOLAB_LOG_STRUCTURED"`
+	LogMultiline        string `env:"DYNOLAB_LOG_MULTILINE"`
+
+	LogSpoolDir     string `env:"DYNOLAB_LOG_SPOOL_DIR"`
+	LogSpoolMaxSize int64  `env:"DYNOLAB_LOG_SPOOL_MAX_SIZE"`
+	LogSpoolSync    string `env:"DYNOLAB_LOG_SPOOL_SYNC,default=segment"`
+
+	LogRateLimitLines float64 `env:"DYNOLAB_LOG_RATE_LIMIT_LINES"`
+	LogRateLimitBytes float64 `env:"DYNOLAB_LOG_RATE_LIMIT_BYTES"`
+	LogDebugSampling  int     `env:"DYNOLAB_LOG_DEBUG_SAMPLING"`
+
+	LogRedact        bool   `env:"DYNOLAB_LOG_REDACT"`
+	LogRedactPattern string `env:"DYNOLAB_LOG_REDACT_PATTERN"`
+
+	Subnet    string `env:"DYNOLAB_SUBNET,default=192.168.1.0/24"`
+	Gateway   string `env:"DYNOLAB_GATEWAY,default=192.168.1.1"`
+	Interface string `env:"DYNOLAB_INTERFACE,default=dyno0"`
+	IP        string `env:"DYNOLAB_IP,default=192.168.1.42"`
+	Debug     bool   `env:"DYNOLAB_DEBUG"`
+
+	MTU                int `env:"DYNOLAB_MTU,default=1500"`
+	TxQueueLen         int `env:"DYNOLAB_TX_QUEUE_LEN,default=1000"`
+	RxWindowLen        int `env:"DYNOLAB_RX_WINDOW_LEN"`
+	MaxEgressConnCount int `env:"DYNOLAB_MAX_EGRESS_CONN_COUNT"`
+
+	ShutdownPeriod time.Duration `env:"DYNOLAB_SHUTDOWN_PERIOD,default=30s"`
+
+	UID          int    `env:"DYNOLAB_UID"`
+	GID          int    `env:"DYNOLAB_GID"`
+	Capabilities string `env:"DYNOLAB_CAPABILITIES"`
+	LoadSeccomp  bool   `env:"DYNOLAB_LOAD_SECCOMP"`
+
+	AddProcHidepidFlag bool `env:"DYNOLAB_PROC_HIDEPID"`
+}
+
+func runCmd(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	specPath := fs.String("spec", "", "load the dyno configuration from a JSON or TOML spec `file`")
+	writeSpecPath := fs.String("write-spec", "", "write the dyno configuration to a JSON or TOML spec `file` before starting")
+	writeSpecEnv := fs.Bool("write-spec-env", false, "include the dyno environment, which may hold secrets, in the -write-spec file")
+	seccompAuditPath := fs.String("seccomp-audit", "", "count the dyno syscalls and write a JSON histogram and allow-list profile to `file` at exit")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dynolab run [flags] -- command [args...]")
+		fmt.Fprintln(os.Stderr, "       dynolab run [flags] -spec file")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	commandLine := fs.Args()
+	if (len(commandLine) == 0) == (*specPath == "") {
+		fs.Usage()
+		return 2
+	}
+
+	var cfg runConfig
+	if err := envdecode.Decode(&cfg); err != nil && err != envdecode.ErrNoTargetFieldsAreSet {
+		log.Print(err)
+		return 1
+	}
+
+	env, err := exec.CleanedEnv(&cfg, os.Environ())
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+
+	var (
+		dyno    *exec.Dyno
+		network *networking.Network
+	)
+	if *specPath != "" {
+		s, err := spec.Load(*specPath)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if dyno, network, err = s.Build(); err != nil {
+			log.Print(err)
+			return 1
+		}
+		if n := s.Network; n != nil {
+			if n.IP != "" {
+				cfg.IP = n.IP
+			}
+			if n.Interface != "" {
+				cfg.Interface = n.Interface
+			}
+		}
+		if dyno.Env == nil {
+			dyno.Env = env
+		}
+	} else {
+		dyno = &exec.Dyno{
+			CommandLine: commandLine,
+			Env:         env,
+
+			ShutdownPeriod: cfg.ShutdownPeriod,
+
+			UID: cfg.UID,
+			GID: cfg.GID,
+
+			AddProcHidepidFlag: cfg.AddProcHidepidFlag,
+		}
+		if cfg.Capabilities != "" {
+			dyno.Capabilities = strings.Split(cfg.Capabilities, ",")
+		}
+		if cfg.LoadSeccomp {
+			dyno.LoadSeccomp = seccomp.DefaultProfile
+		}
+	}
+	dyno.Stdin = os.Stdin
+	dyno.AuditSeccomp = *seccompAuditPath != ""
+
+	if network == nil {
+		if network, err = cfg.network(); err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+	if ip := net.ParseIP(cfg.IP).To4(); ip == nil || !network.Subnet.Contains(ip) {
+		log.Printf("dyno address %q is not part of subnet %s", cfg.IP, network.Subnet)
+		return 1
+	}
+
+	if *writeSpecPath != "" {
+		s, err := spec.FromDyno(dyno, network)
+		if err != nil {
+			log.Print(err)
+			return 1
+		}
+		if !*writeSpecEnv {
+			s.Dyno.Env = nil
+		}
+		s.Network.IP, s.Network.Interface = cfg.IP, cfg.Interface
+		if err := s.Save(*writeSpecPath); err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+
+	err = run(cfg, network, dyno)
+
+	if report := dyno.SeccompAudit(); report != nil {
+		if err := writeSeccompAudit(*seccompAuditPath, report); err != nil {
+			log.Print(err)
+		}
+	}
+
+	if err != nil {
+		var status exec.ExitStatus
+		if !errors.As(err, &status) {
+			log.Print(err)
+			return 1
+		}
+
+		// the dyno was interrupted by a failing sidecar.
+		var rerr *supervisor.RunError
+		if errors.As(err, &rerr) && rerr.Trigger() != error(status) {
+			log.Print(err)
+		}
+		return status.ExitCode()
+	}
+	return 0
+}
+
+// run sets up the network namespace, starts the sidecar actors and the dyno
+// process group, and blocks until the first actor exits.
+func run(cfg runConfig, network *networking.Network, dyno *exec.Dyno) error {
+	// the network namespace and capabilities are thread local state, the
+	// dyno process must be started from the same system thread.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := network.Setup(); err != nil {
+		return err
+	}
+	if err := network.AddTUN(cfg.Interface, net.ParseIP(cfg.IP).To4()); err != nil {
+		return err
+	}
+
+	bridge := &networking.Bridge{
+		Network: network,
+	}
+
+	lnNAT, err := bridge.Listen("tcp+udp", "0.0.0.0/0:0")
+	if err != nil {
+		return err
+	}
+
+	nat := &networking.NAT{
+		EgressListener: lnNAT,
+		EgressDial: func(addr net.Addr) (net.Conn, error) {
+			return net.Dial(addr.Network(), addr.String())
+		},
+	}
+
+	var (
+		forwarder *logging.Forwarder
+		events    chan exec.Event
+	)
+	if cfg.LogdrainURL != "" {
+		stdoutr, stdoutw := io.Pipe()
+		stderrr, stderrw := io.Pipe()
+		dyno.Stdout, dyno.Stderr = stdoutw, stderrw
+
+		policy, err := logging.ParseErrorPolicy(cfg.LogErrorPolicy)
+		if err != nil {
+			return err
+		}
+
+		forwarder = &logging.Forwarder{
+			LogdrainURLs:     strings.Split(cfg.LogdrainURL, ","),
+			AppName:          cfg.AppName,
+			AppID:            cfg.AppID,
+			ProcessID:        cfg.ProcessID,
+			ErrorPolicy:      policy,
+			FailureThreshold: cfg.LogFailureThreshold,
+			DebugSampling:    cfg.LogDebugSampling,
+		}
+		if cfg.LogRedact {
+			redaction := &logging.Redaction{
+				Env:      dyno.Env,
+				Patterns: []*regexp.Regexp{logging.CreditCardPattern, logging.BearerTokenPattern},
+			}
+			if cfg.LogRedactPattern != "" {
+				re, err := regexp.Compile(cfg.LogRedactPattern)
+				if err != nil {
+					return err
+				}
+				redaction.Patterns = append(redaction.Patterns, re)
+			}
+			forwarder.Redaction = redaction
+		}
+		if cfg.LogRateLimitLines > 0 || cfg.LogRateLimitBytes > 0 {
+			forwarder.RateLimit = &logging.RateLimit{
+				LinesPerSecond: cfg.LogRateLimitLines,
+				BytesPerSecond: cfg.LogRateLimitBytes,
+			}
+		}
+		if cfg.LogSpoolDir != "" {
+			sync, err := logging.ParseSyncPolicy(cfg.LogSpoolSync)
+			if err != nil {
+				return err
+			}
+			forwarder.Spool = &logging.Spool{
+				Dir:     cfg.LogSpoolDir,
+				MaxSize: cfg.LogSpoolMaxSize,
+				Sync:    sync,
+			}
+		}
+
+		var multiline *logging.Multiline
+		if cfg.LogMultiline != "" {
+			multiline = &logging.Multiline{}
+			for _, lang := range strings.Split(cfg.LogMultiline, ",") {
+				re, err := logging.LanguageContinuation(lang)
+				if err != nil {
+					return err
+				}
+				multiline.Patterns = append(multiline.Patterns, re)
+			}
+		}
+
+		forwarder.ForwardStream(stdoutr, logging.Stream{
+			ProcID:     cfg.ProcessID,
+			Structured: cfg.LogStructured,
+			Multiline:  multiline,
+		})
+		forwarder.ForwardStream(stderrr, logging.Stream{
+			ProcID:     cfg.ProcessID + "/stderr",
+			Severity:   logging.SeverityError,
+			Structured: cfg.LogStructured,
+			Multiline:  multiline,
+		})
+
+		// lifecycle events are forwarded as system lines, until the dyno
+		// has exited.
+		events = make(chan exec.Event, 16)
+		dyno.Notify(events)
+		systemw := forwarder.ForwardSystem()
+		go func() {
+			defer systemw.Close()
+			for e := range events {
+				fmt.Fprintln(systemw, e)
+			}
+		}()
+	} else {
+		dyno.Stdout, dyno.Stderr = nopCloser{os.Stdout}, nopCloser{os.Stderr}
+	}
+
+	if err := dyno.Start(); err != nil {
+		return err
+	}
+
+	// actors are interrupted in reverse order: the dyno is stopped first so
+	// that its remaining output, connections and mediated syscalls drain
+	// through the sidecars.
+
+	var g supervisor.Group
+	err = g.StartActor(supervisor.Actor{
+		Name:      "nat",
+		Execute:   nat.Run,
+		Interrupt: nat.Stop,
+		Restart: supervisor.Restart{
+			Policy:      supervisor.RestartOnFailure,
+			MaxRestarts: 5,
+			Window:      time.Minute,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if forwarder != nil {
+		err := g.StartActor(supervisor.Actor{
+			Name:      "forwarder",
+			Execute:   forwarder.Run,
+			Interrupt: forwarder.Stop,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if listener := dyno.SeccompListener(); listener != nil {
+		err := g.StartActor(supervisor.Actor{
+			Name:      "seccomp",
+			Execute:   listener.Run,
+			Interrupt: listener.Stop,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = g.StartActor(supervisor.Actor{
+		Name: "dyno",
+		Execute: func() error {
+			err := dyno.Run()
+			if events != nil {
+				dyno.StopNotify(events)
+				close(events)
+			}
+			return err
+		},
+		Interrupt: dyno.Stop,
+	})
+	if err != nil {
+		return err
+	}
+
+	return g.Run()
+}
+
+func (c runConfig) network() (*networking.Network, error) {
+	_, subnet, err := net.ParseCIDR(c.Subnet)
+	if err != nil {
+		return nil, err
+	}
+
+	gateway := net.ParseIP(c.Gateway).To4()
+	if gateway == nil {
+		return nil, fmt.Errorf("invalid gateway address %q", c.Gateway)
+	}
+	return &networking.Network{
+		Subnet:  subnet,
+		Gateway: gateway,
+		Debug:   c.Debug,
+
+		MTU: c.MTU,
+
+		TxQueueLen:  c.TxQueueLen,
+		RxWindowLen: c.RxWindowLen,
+
+		MaxEgressConnCount: c.MaxEgressConnCount,
+	}, nil
+}
+
+// writeSeccompAudit writes the syscall histogram of an audited dyno to path,
+// along with the allow-list profile generated from it.
+func writeSeccompAudit(path string, report *seccomp.AuditReport) error {
+	data, err := json.MarshalIndent(struct {
+		*seccomp.AuditReport
+		Profile *seccomp.Profile `json:"profile"`
+	}{
+		AuditReport: report,
+		Profile:     report.Profile(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// nopCloser prevents the dyno from closing the stdout & stderr of the
+// dynolab process.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
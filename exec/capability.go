@@ -0,0 +1,190 @@
+package exec
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Linux capabilities. See include/uapi/linux/capability.h in Linux.
+const (
+	capChown = iota
+	capDacOverride
+	capDacReadSearch
+	capFowner
+	capFsetid
+	capKill
+	capSetgid
+	capSetuid
+	capSetpcap
+	capLinuxImmutable
+	capNetBindService
+	capNetBroadcast
+	capNetAdmin
+	capNetRaw
+	capIpcLock
+	capIpcOwner
+	capSysModule
+	capSysRawio
+	capSysChroot
+	capSysPtrace
+	capSysPacct
+	capSysAdmin
+	capSysBoot
+	capSysNice
+	capSysResource
+	capSysTime
+	capSysTTYConfig
+	capMknod
+	capLease
+	capAuditWrite
+	capAuditControl
+	capSetfcap
+	capMacOverride
+	capMacAdmin
+	capSyslog
+	capWakeAlarm
+	capBlockSuspend
+	capAuditRead
+	capPerfmon
+	capBPF
+	capCheckpointRestore
+)
+
+var capTable = map[string]int{
+	"CAP_CHOWN":              capChown,
+	"CAP_DAC_OVERRIDE":       capDacOverride,
+	"CAP_DAC_READ_SEARCH":    capDacReadSearch,
+	"CAP_FOWNER":             capFowner,
+	"CAP_FSETID":             capFsetid,
+	"CAP_KILL":               capKill,
+	"CAP_SETGID":             capSetgid,
+	"CAP_SETUID":             capSetuid,
+	"CAP_SETPCAP":            capSetpcap,
+	"CAP_LINUX_IMMUTABLE":    capLinuxImmutable,
+	"CAP_NET_BIND_SERVICE":   capNetBindService,
+	"CAP_NET_BROADCAST":      capNetBroadcast,
+	"CAP_NET_ADMIN":          capNetAdmin,
+	"CAP_NET_RAW":            capNetRaw,
+	"CAP_IPC_LOCK":           capIpcLock,
+	"CAP_IPC_OWNER":          capIpcOwner,
+	"CAP_SYS_MODULE":         capSysModule,
+	"CAP_SYS_RAWIO":          capSysRawio,
+	"CAP_SYS_CHROOT":         capSysChroot,
+	"CAP_SYS_PTRACE":         capSysPtrace,
+	"CAP_SYS_PACCT":          capSysPacct,
+	"CAP_SYS_ADMIN":          capSysAdmin,
+	"CAP_SYS_BOOT":           capSysBoot,
+	"CAP_SYS_NICE":           capSysNice,
+	"CAP_SYS_RESOURCE":       capSysResource,
+	"CAP_SYS_TIME":           capSysTime,
+	"CAP_SYS_TTY_CONFIG":     capSysTTYConfig,
+	"CAP_MKNOD":              capMknod,
+	"CAP_LEASE":              capLease,
+	"CAP_AUDIT_WRITE":        capAuditWrite,
+	"CAP_AUDIT_CONTROL":      capAuditControl,
+	"CAP_SETFCAP":            capSetfcap,
+	"CAP_MAC_OVERRIDE":       capMacOverride,
+	"CAP_MAC_ADMIN":          capMacAdmin,
+	"CAP_SYSLOG":             capSyslog,
+	"CAP_WAKE_ALARM":         capWakeAlarm,
+	"CAP_BLOCK_SUSPEND":      capBlockSuspend,
+	"CAP_AUDIT_READ":         capAuditRead,
+	"CAP_PERFMON":            capPerfmon,
+	"CAP_BPF":                capBPF,
+	"CAP_CHECKPOINT_RESTORE": capCheckpointRestore,
+}
+
+// IsCapability reports whether name is a capability supported by
+// Dyno.Capabilities.
+func IsCapability(name string) bool {
+	_, ok := capTable[name]
+	return ok
+}
+
+// CapabilitySets configures each capability set of the dyno process
+// independently. A nil set leaves the corresponding set of the dyno process
+// unchanged. Capabilities must be in the permitted and inheritable sets to be
+// raised in the ambient set.
+type CapabilitySets struct {
+	Effective   []string
+	Permitted   []string
+	Inheritable []string
+	Ambient     []string
+	Bounding    []string
+
+	// NoNewPrivs sets the no_new_privs bit, which prevents execve from
+	// granting privileges (e.g. via setuid binaries or file capabilities).
+	NoNewPrivs bool
+}
+
+// capabilityMasks are the parsed capability sets of a CapabilitySets. A nil
+// mask leaves the corresponding set unchanged.
+type capabilityMasks struct {
+	effective, permitted, inheritable, ambient, bounding *uint64
+
+	noNewPrivs bool
+}
+
+func (cs *CapabilitySets) masks() (*capabilityMasks, error) {
+	m := &capabilityMasks{
+		noNewPrivs: cs.NoNewPrivs,
+	}
+
+	sets := []struct {
+		names []string
+		mask  **uint64
+	}{
+		{cs.Effective, &m.effective},
+		{cs.Permitted, &m.permitted},
+		{cs.Inheritable, &m.inheritable},
+		{cs.Ambient, &m.ambient},
+		{cs.Bounding, &m.bounding},
+	}
+
+	for _, set := range sets {
+		if set.names == nil {
+			continue
+		}
+
+		mask, err := capabilityMask(set.names)
+		if err != nil {
+			return nil, err
+		}
+		*set.mask = &mask
+	}
+	return m, nil
+}
+
+// capabilityName returns the name of the capability cap.
+func capabilityName(cap int) string {
+	for name, c := range capTable {
+		if c == cap {
+			return name
+		}
+	}
+	return "capability " + strconv.Itoa(cap)
+}
+
+// checkLastCapability returns an error if mask holds capabilities above last,
+// the last capability supported by the kernel.
+func checkLastCapability(mask uint64, last int) error {
+	for cap := last + 1; cap < 64; cap++ {
+		if mask&(1<<uint(cap)) != 0 {
+			return errors.New("exec: capability unsupported by the kernel: " + capabilityName(cap))
+		}
+	}
+	return nil
+}
+
+// capabilityMask returns the bit mask of the named capabilities.
+func capabilityMask(names []string) (uint64, error) {
+	var mask uint64
+	for _, name := range names {
+		cap, ok := capTable[name]
+		if !ok {
+			return 0, errors.New("exec: unknown capability: " + name)
+		}
+		mask |= 1 << uint(cap)
+	}
+	return mask, nil
+}
@@ -0,0 +1,107 @@
+package exec
+
+import (
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	prCapAmbient         = 47
+	prCapAmbientRaise    = 2
+	prCapAmbientClearAll = 4
+)
+
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// apply sets the capabilities of the calling thread. The bounding set is
+// limited first, while CAP_SETPCAP may still be effective, and the ambient set
+// is raised last, once the capabilities are permitted & inheritable.
+func (m *capabilityMasks) apply() error {
+	if m.bounding != nil {
+		for cap := 0; true; cap++ {
+			if err := unix.Prctl(syscall.PR_CAPBSET_READ, uintptr(cap), 0, 0, 0); err != nil {
+				if err != syscall.EINVAL {
+					return err
+				}
+
+				// cap is above the last capability of the kernel.
+				if err := checkLastCapability(*m.bounding, cap-1); err != nil {
+					return err
+				}
+				break
+			}
+
+			if *m.bounding&(1<<uint(cap)) != 0 {
+				continue
+			}
+
+			if err := unix.Prctl(syscall.PR_CAPBSET_DROP, uintptr(cap), 0, 0, 0); err != nil {
+				return err
+			}
+		}
+	}
+
+	if m.effective != nil || m.permitted != nil || m.inheritable != nil {
+		var (
+			hdr  capHeader
+			data [2]capData
+		)
+
+		if _, _, err := syscall.Syscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(nil)), 0); err != 0 {
+			return err
+		}
+		if _, _, err := syscall.Syscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); err != 0 {
+			return err
+		}
+
+		if m.effective != nil {
+			data[0].effective, data[1].effective = uint32(*m.effective), uint32(*m.effective>>32)
+		}
+		if m.permitted != nil {
+			data[0].permitted, data[1].permitted = uint32(*m.permitted), uint32(*m.permitted>>32)
+		}
+		if m.inheritable != nil {
+			data[0].inheritable, data[1].inheritable = uint32(*m.inheritable), uint32(*m.inheritable>>32)
+		}
+
+		hdr.pid = int32(syscall.Gettid())
+		if _, _, err := syscall.Syscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&hdr)), uintptr(unsafe.Pointer(&data[0])), 0); err != 0 {
+			return err
+		}
+	}
+
+	if m.ambient != nil {
+		if err := unix.Prctl(prCapAmbient, prCapAmbientClearAll, 0, 0, 0); err != nil {
+			return err
+		}
+
+		for cap := 0; cap < 64; cap++ {
+			if *m.ambient&(1<<uint(cap)) == 0 {
+				continue
+			}
+
+			if err := unix.Prctl(prCapAmbient, prCapAmbientRaise, uintptr(cap), 0, 0); err != nil {
+				return err
+			}
+		}
+	}
+
+	if m.noNewPrivs {
+		if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package exec
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// EventType is the type of a dyno lifecycle event.
+type EventType int
+
+// Dyno lifecycle events.
+const (
+	// EventStarted is the start of the dyno process, with its Pid.
+	EventStarted EventType = iota
+
+	// EventSignaled is a Signal forwarded to the dyno process group.
+	EventSignaled
+
+	// EventShutdown is the beginning of the shutdown Period, after a
+	// SIGTERM.
+	EventShutdown
+
+	// EventKilled is the SIGKILL of the dyno process group, once its
+	// shutdown Period has elapsed.
+	EventKilled
+
+	// EventExited is the exit of the dyno process, with the Err returned by
+	// Run. It is the last event of the dyno.
+	EventExited
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventStarted:
+		return "started"
+	case EventSignaled:
+		return "signaled"
+	case EventShutdown:
+		return "shutdown"
+	case EventKilled:
+		return "killed"
+	case EventExited:
+		return "exited"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a lifecycle event of a dyno.
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	Pid    int
+	Signal syscall.Signal
+	Period time.Duration
+	Err    error
+}
+
+// String returns the Heroku-style log line of e.
+func (e Event) String() string {
+	switch e.Type {
+	case EventStarted:
+		return fmt.Sprintf("Starting process with pid %d", e.Pid)
+	case EventSignaled:
+		if e.Signal == syscall.SIGTERM {
+			return "Stopping all processes with SIGTERM"
+		}
+		return fmt.Sprintf("Forwarding %s to all processes", signalName(e.Signal))
+	case EventShutdown:
+		return fmt.Sprintf("Waiting %s for processes to exit", e.Period)
+	case EventKilled:
+		return fmt.Sprintf("Error R12 (Exit timeout) -> Processes failed to exit within %s of SIGTERM, stopping them with SIGKILL", e.Period)
+	case EventExited:
+		status, ok := e.Err.(ExitStatus)
+		switch {
+		case !ok:
+			return fmt.Sprintf("Process failed: %v", e.Err)
+		case status.Signaled():
+			return fmt.Sprintf("Process exited with status %d (%v)", status.ExitCode(), status)
+		default:
+			return fmt.Sprintf("Process exited with status %d", status.Code)
+		}
+	default:
+		return e.Type.String()
+	}
+}
+
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGSTOP: "SIGSTOP",
+	syscall.SIGTSTP: "SIGTSTP",
+	syscall.SIGCHLD: "SIGCHLD",
+	syscall.SIGCONT: "SIGCONT",
+}
+
+// signalName returns the name of the forwarded signal sig.
+func signalName(sig syscall.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return sig.String()
+}
+
+// Notify causes the dyno to relay its lifecycle events to c. The dyno does
+// not block sending to c: the caller must ensure that c has sufficient
+// buffer space to keep up with the expected event rate.
+func (d *Dyno) Notify(c chan<- Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.notify = append(d.notify, c)
+}
+
+// StopNotify causes the dyno to stop relaying events to c.
+func (d *Dyno) StopNotify(c chan<- Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, n := range d.notify {
+		if n == c {
+			d.notify = append(d.notify[:i], d.notify[i+1:]...)
+			return
+		}
+	}
+}
+
+// emit relays e to the notified channels.
+func (d *Dyno) emit(e Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e.Time = time.Now()
+	for _, c := range d.notify {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
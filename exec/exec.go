@@ -8,10 +8,13 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/joeshaw/envdecode"
+
+	"github.com/heroku/dynolab/seccomp"
 )
 
 var forwardedSignals = []os.Signal{
@@ -62,15 +65,34 @@ type Dyno struct {
 
 	UID, GID     int
 	Capabilities []string
-	LoadSeccomp  bool
+
+	// LoadSeccomp is the seccomp profile loaded for the dyno process, if set.
+	LoadSeccomp *seccomp.Profile
+
+	// SeccompHandler responds to the ActUserNotif syscalls of LoadSeccomp.
+	// It is run by the SeccompListener actor.
+	SeccompHandler seccomp.Handler
+
+	// AuditSeccomp loads the seccomp AuditProfile for the dyno process, on
+	// top of LoadSeccomp, and counts its syscalls with the SeccompListener
+	// actor. Audited syscalls are significantly slower.
+	AuditSeccomp bool
+
+	// CapabilitySets replaces Capabilities when set.
+	CapabilitySets *CapabilitySets
 
 	AddProcHidepidFlag bool
 
 	Stdin          io.Reader
 	Stdout, Stderr io.WriteCloser
 
-	cmd  *exec.Cmd
-	sigc chan os.Signal
+	cmd      *exec.Cmd
+	sigc     chan os.Signal
+	listener *seccomp.Listener
+	auditor  *seccomp.Auditor
+
+	mu     sync.Mutex
+	notify []chan<- Event
 }
 
 // Start launches a dyno process group.
@@ -100,13 +122,18 @@ func (d *Dyno) Start() error {
 
 	if err := d.start(); err != nil {
 		signal.Stop(d.sigc)
+		if d.listener != nil {
+			d.listener.Stop(err)
+		}
 		return err
 	}
+
+	d.emit(Event{Type: EventStarted, Pid: d.cmd.Process.Pid})
 	return nil
 }
 
 // Run blocks until the dyno process group has exited and returns
-// the exit code as an ExitCode error.
+// the exit status as an ExitStatus error.
 func (d *Dyno) Run() error {
 	if d.Stderr != nil {
 		defer d.Stderr.Close()
@@ -117,8 +144,10 @@ func (d *Dyno) Run() error {
 
 	err := d.wait()
 	if _, ok := err.(*exec.ExitError); err == nil || ok {
-		return ExitCode(d.ExitCode())
+		err = d.ExitStatus()
 	}
+
+	d.emit(Event{Type: EventExited, Err: err})
 	return err
 }
 
@@ -144,11 +173,14 @@ func (d *Dyno) wait() error {
 			if !d.kill(sig.(syscall.Signal)) {
 				return <-errc
 			}
+			d.emit(Event{Type: EventSignaled, Signal: sig.(syscall.Signal)})
 
 			if d.ShutdownPeriod > 0 && sig == os.Signal(syscall.SIGTERM) {
 				shutdownc = time.After(d.ShutdownPeriod)
+				d.emit(Event{Type: EventShutdown, Period: d.ShutdownPeriod})
 			}
 		case <-shutdownc:
+			d.emit(Event{Type: EventKilled, Signal: syscall.SIGKILL, Period: d.ShutdownPeriod})
 			if !d.kill(syscall.SIGKILL) {
 				return <-errc
 			}
@@ -176,13 +208,100 @@ func (d *Dyno) Stop(error) {
 	d.sigc <- syscall.SIGTERM
 }
 
+// SeccompListener returns the listener of the dyno's seccomp notifications
+// once started, or nil if SeccompHandler is unset. It must be run alongside
+// the dyno, and stopped after the dyno has exited.
+func (d *Dyno) SeccompListener() *seccomp.Listener {
+	return d.listener
+}
+
+// SeccompAudit returns the syscall histogram of the dyno processes, or nil
+// if AuditSeccomp is unset.
+func (d *Dyno) SeccompAudit() *seccomp.AuditReport {
+	if d.auditor == nil {
+		return nil
+	}
+	return d.auditor.Report()
+}
+
+// capabilitySets returns the capability configuration of d, or nil if the
+// capabilities of the dyno process are unchanged. Capabilities are raised
+// into the inheritable & ambient sets and limit the bounding set.
+func (d *Dyno) capabilitySets() *CapabilitySets {
+	switch {
+	case d.CapabilitySets != nil:
+		return d.CapabilitySets
+	case d.Capabilities != nil:
+		return &CapabilitySets{
+			Inheritable: d.Capabilities,
+			Ambient:     d.Capabilities,
+			Bounding:    d.Capabilities,
+		}
+	default:
+		return nil
+	}
+}
+
+// ExitStatus is the exit status of the parent process in the dyno
+// process group.
+func (d *Dyno) ExitStatus() ExitStatus {
+	return exitStatus(d.cmd.ProcessState.Sys().(syscall.WaitStatus))
+}
+
+// ExitStatus is the error exit status of a process, which either exited
+// with Code, or was terminated by Signal.
+type ExitStatus struct {
+	Code int
+
+	Signal     syscall.Signal
+	CoreDumped bool
+}
+
+func exitStatus(ws syscall.WaitStatus) ExitStatus {
+	if ws.Signaled() {
+		return ExitStatus{Signal: ws.Signal(), CoreDumped: ws.CoreDump()}
+	}
+	return ExitStatus{Code: ws.ExitStatus()}
+}
+
+// Exited reports whether the process exited.
+func (s ExitStatus) Exited() bool { return s.Signal == 0 }
+
+// Signaled reports whether the process was terminated by a signal.
+func (s ExitStatus) Signaled() bool { return s.Signal != 0 }
+
+// ExitCode returns the exit code of the process, using the shell convention
+// of 128+n for processes terminated by signal n.
+func (s ExitStatus) ExitCode() int {
+	if s.Signaled() {
+		return 128 + int(s.Signal)
+	}
+	return s.Code
+}
+
+func (s ExitStatus) Error() string {
+	if !s.Signaled() {
+		return "exit " + strconv.Itoa(s.Code)
+	}
+
+	msg := "killed by signal " + strconv.Itoa(int(s.Signal))
+	if s.CoreDumped {
+		msg += ", core dumped"
+	}
+	return msg
+}
+
 // ExitCode is the exit code of the parent process in the dyno
 // process group.
+//
+// Deprecated: use ExitStatus, which also reports signal deaths.
 func (d *Dyno) ExitCode() ExitCode {
-	return ExitCode(d.cmd.ProcessState.Sys().(syscall.WaitStatus))
+	return ExitCode(d.ExitStatus().ExitCode())
 }
 
 // ExitCode is an error exit code.
+//
+// Deprecated: Run returns an ExitStatus error.
 type ExitCode int
 
 func (c ExitCode) Error() string { return "exit " + strconv.Itoa(int(c)) }
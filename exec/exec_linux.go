@@ -1,8 +1,9 @@
 package exec
 
 import (
+	"errors"
 	"os"
-	"sort"
+	"runtime"
 	"syscall"
 	"unsafe"
 
@@ -11,128 +12,146 @@ import (
 	"github.com/heroku/dynolab/seccomp"
 )
 
-const (
-	capKill           = 5
-	capSetuid         = 7
-	capSetpcap        = 8
-	capNetBindService = 10
-	capNetAdmin       = 12
-	capSysAdmin       = 21
-	capAuditWrite     = 29
-
-	prCapAmbient      = 47
-	prCapAmbientRaise = 2
-	prCapAmbientLower = 3
+var (
+	errNoSeccompHandler = errors.New("exec: seccomp profile notifies syscalls without a handler")
+	errSeccompAudit     = errors.New("exec: seccomp audit conflicts with a seccomp handler")
+)
 
+const (
 	prSetChildSubreaper = 36
 
 	pAll = 0
 )
 
-var capTable = map[string]int{
-	"CAP_AUDIT_WRITE":      capAuditWrite,
-	"CAP_KILL":             capKill,
-	"CAP_NET_ADMIN":        capNetAdmin,
-	"CAP_NET_BIND_SERVICE": capNetBindService,
-	"CAP_SETUID":           capSetuid,
-	"CAP_SYS_ADMIN":        capSysAdmin,
-}
-
 func (d *Dyno) start() error {
-	// setup init functionality
-
-	if err := unix.Prctl(prSetChildSubreaper, 1, 0, 0, 0); err != nil {
-		return err
+	var capMasks *capabilityMasks
+	if caps := d.capabilitySets(); caps != nil {
+		var err error
+		if capMasks, err = caps.masks(); err != nil {
+			return err
+		}
 	}
 
-	// drop unshare syscall via seccomp
+	var seccompProg seccomp.Program
+	if d.LoadSeccomp != nil {
+		if d.LoadSeccomp.UsesUserNotif() && d.SeccompHandler == nil {
+			return errNoSeccompHandler
+		}
 
-	if d.LoadSeccomp {
-		if err := seccomp.Load(); err != nil {
+		var err error
+		if seccompProg, err = seccomp.Compile(d.LoadSeccomp); err != nil {
 			return err
 		}
 	}
 
-	// remount /proc with hidepid=2
+	var auditProg seccomp.Program
+	if d.AuditSeccomp {
+		// a single listener can be installed per thread.
+		if d.SeccompHandler != nil {
+			return errSeccompAudit
+		}
 
-	if d.AddProcHidepidFlag {
-		if err := syscall.Mount("", "/proc", "proc", syscall.MS_REMOUNT, "hidepid=2"); err != nil {
+		var err error
+		if auditProg, err = seccomp.Compile(seccomp.AuditProfile()); err != nil {
 			return err
 		}
 	}
 
-	// drop all capabilities before re-adding
+	// setup init functionality
+
+	if err := unix.Prctl(prSetChildSubreaper, 1, 0, 0, 0); err != nil {
+		return err
+	}
+
+	// a thread loading a seccomp listener is filtered until it exits.
+
+	if (seccompProg != nil && d.SeccompHandler != nil) || auditProg != nil {
+		return d.spawnThread(seccompProg, auditProg, capMasks)
+	}
+	return d.spawn(seccompProg, auditProg, capMasks)
+}
+
+// spawnThread calls spawn from a dedicated system thread, in the network
+// namespace of the calling thread. The syscalls of a thread loading a seccomp
+// listener are notified, and fail once the listener is stopped: the thread
+// exits with its goroutine rather than being handed back to the runtime.
+func (d *Dyno) spawnThread(seccompProg, auditProg seccomp.Program, capMasks *capabilityMasks) error {
+	netns, err := os.Open("/proc/thread-self/ns/net")
+	if err != nil {
+		return err
+	}
+	defer netns.Close()
 
-	if d.Capabilities != nil {
-		var caps []int
-		for _, name := range d.Capabilities {
-			cap, ok := capTable[name]
-			if !ok {
-				panic("unknown capability: " + name)
+	fi, err := netns.Stat()
+	if err != nil {
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		// the thread is never unlocked.
+		runtime.LockOSThread()
+
+		cur, err := os.Stat("/proc/thread-self/ns/net")
+		if err != nil {
+			errc <- err
+			return
+		}
+		if !os.SameFile(fi, cur) {
+			if err := unix.Setns(int(netns.Fd()), unix.CLONE_NEWNET); err != nil {
+				errc <- err
+				return
 			}
-			caps = append(caps, cap)
 		}
-		sort.Ints(caps)
 
-		c := struct {
-			hdr struct {
-				_version uint32 // nolint: unused
-				pid      int
-			}
-			data [2]struct {
-				_effective  uint32 // nolint: unused
-				_permitted  uint32 // nolint: unused
-				inheritable uint32
-			}
-		}{}
+		errc <- d.spawn(seccompProg, auditProg, capMasks)
+	}()
+	return <-errc
+}
 
-		if _, _, err := syscall.Syscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&c.hdr)), uintptr(unsafe.Pointer(nil)), 0); err != 0 {
+// spawn restricts the calling thread and starts the dyno process from it.
+func (d *Dyno) spawn(seccompProg, auditProg seccomp.Program, capMasks *capabilityMasks) error {
+	// restrict syscalls via seccomp
+
+	switch {
+	case seccompProg != nil && d.SeccompHandler != nil:
+		l, err := seccomp.LoadListener(seccompProg, d.SeccompHandler)
+		if err != nil {
 			return err
 		}
-		if _, _, err := syscall.Syscall(syscall.SYS_CAPGET, uintptr(unsafe.Pointer(&c.hdr)), uintptr(unsafe.Pointer(&c.data[0])), 0); err != 0 {
+		d.listener = l
+	case seccompProg != nil:
+		if err := seccomp.LoadProgram(seccompProg); err != nil {
 			return err
 		}
+	}
 
-		c.data[0].inheritable = 0x0
-		c.data[1].inheritable = 0x0
-
-		for cap := 0; true; cap++ {
-			if idx := sort.SearchInts(caps, cap); idx < len(caps) && caps[idx] == cap {
-				if err := unix.Prctl(prCapAmbient, prCapAmbientRaise, uintptr(cap), 0, 0); err != nil {
-					return err
-				}
-
-				if idx = 0; cap >= 32 {
-					idx = 1
-				}
-				c.data[idx].inheritable |= uint32(1 << uint(cap))
-
-				continue
-			}
-
-			if err := unix.Prctl(prCapAmbient, prCapAmbientLower, uintptr(cap), 0, 0); err != nil {
-				if err == syscall.EINVAL {
-					break
-				}
-				return err
-			}
+	if auditProg != nil {
+		// the syscalls of this thread are notified, but not audited.
+		d.auditor = &seccomp.Auditor{
+			IgnorePid: unix.Gettid(),
+		}
 
-			if cap != capSetpcap {
-				if err := unix.Prctl(syscall.PR_CAPBSET_DROP, uintptr(cap), 0, 0, 0); err != nil {
-					return err
-				}
-			}
+		l, err := seccomp.LoadListener(auditProg, d.auditor)
+		if err != nil {
+			return err
 		}
+		d.listener = l
+	}
+
+	// remount /proc with hidepid=2
 
-		c.hdr.pid = syscall.Gettid()
-		if _, _, err := syscall.Syscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&c.hdr)), uintptr(unsafe.Pointer(&c.data[0])), 0); err != 0 {
+	if d.AddProcHidepidFlag {
+		if err := syscall.Mount("", "/proc", "proc", syscall.MS_REMOUNT, "hidepid=2"); err != nil {
 			return err
 		}
+	}
 
-		if idx := sort.SearchInts(caps, capSetpcap); idx == len(caps) || caps[idx] != capSetpcap {
-			if err := unix.Prctl(syscall.PR_CAPBSET_DROP, capSetpcap, 0, 0, 0); err != nil {
-				return err
-			}
+	// drop all capabilities before re-adding
+
+	if capMasks != nil {
+		if err := capMasks.apply(); err != nil {
+			return err
 		}
 	}
 
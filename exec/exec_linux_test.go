@@ -10,11 +10,15 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/pkg/errors"
+
+	"github.com/heroku/dynolab/seccomp"
 )
 
 func TestDynoInit(t *testing.T) {
@@ -37,7 +41,7 @@ func TestDynoInit(t *testing.T) {
 	go func() {
 		defer close(errc)
 
-		if want, got := ExitCode(0), dyno.Run(); want != got {
+		if want, got := (ExitStatus{}), dyno.Run(); want != got {
 			errc <- errors.Errorf("want dyno to exit %q, got %q", want, got)
 		}
 	}()
@@ -83,7 +87,7 @@ func TestDynoLoadSeccomp(t *testing.T) {
 			`unshare -U whoami`,
 		},
 
-		LoadSeccomp: true,
+		LoadSeccomp: seccomp.DefaultProfile,
 
 		Stdout: pw,
 		Stderr: pw,
@@ -107,9 +111,138 @@ func TestDynoLoadSeccomp(t *testing.T) {
 		t.Error("unshare syscall was not blocked by seccomp")
 	}
 
-	if want, got := ExitCode(0x100), <-errc; want != got {
+	if want, got := (ExitStatus{Code: 1}), <-errc; want != got {
+		t.Fatalf("want exit code %q, got %q", want, got)
+	}
+}
+
+func TestDynoSeccompHandler(t *testing.T) {
+	pr, pw := io.Pipe()
+
+	handler := func(n *seccomp.Notification) seccomp.Response {
+		pathArg := n.Args[0]
+		if n.Syscall() == "mkdirat" {
+			pathArg = n.Args[1]
+		}
+
+		path, err := n.ReadString(pathArg, 4096)
+		if err != nil {
+			return seccomp.Deny(syscall.EFAULT)
+		}
+		if path == "/tmp/dynolab-denied" {
+			return seccomp.Deny(syscall.EACCES)
+		}
+		return seccomp.Allow()
+	}
+
+	dyno := &Dyno{
+		CommandLine: []string{
+			"/bin/bash", "-c",
+			`mkdir /tmp/dynolab-denied`,
+		},
+
+		LoadSeccomp: &seccomp.Profile{
+			DefaultAction: seccomp.ActAllow,
+			Syscalls: []seccomp.Rule{
+				{Names: []string{"mkdir", "mkdirat"}, Action: seccomp.ActUserNotif},
+			},
+		},
+		SeccompHandler: seccomp.HandlerFunc(handler),
+
+		Stdout: pw,
+		Stderr: pw,
+	}
+
+	if err := dyno.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	listener := dyno.SeccompListener()
+	if listener == nil {
+		t.Fatal("want seccomp listener")
+	}
+
+	lerrc := make(chan error, 1)
+	go func() { lerrc <- listener.Run() }()
+
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		errc <- dyno.Run()
+	}()
+
+	data, err := ioutil.ReadAll(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "Permission denied") {
+		t.Errorf("want mkdir to be denied, got %q", data)
+	}
+
+	if want, got := (ExitStatus{Code: 1}), <-errc; want != got {
+		t.Fatalf("want exit code %q, got %q", want, got)
+	}
+
+	listener.Stop(nil)
+	if err := <-lerrc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDynoAuditSeccomp(t *testing.T) {
+	dyno := &Dyno{
+		CommandLine: []string{
+			"/bin/bash", "-c",
+			`mkdir -p /tmp/dynolab-audit`,
+		},
+
+		LoadSeccomp:  seccomp.DefaultProfile,
+		AuditSeccomp: true,
+
+		// the no_new_privs prctl is called by the supervising thread.
+		CapabilitySets: &CapabilitySets{NoNewPrivs: true},
+	}
+
+	// the dyno is started from a locked thread that exits afterwards, so that
+	// no filtered thread is handed back to the runtime of the test binary.
+	startc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		startc <- dyno.Start()
+	}()
+	if err := <-startc; err != nil {
+		t.Fatal(err)
+	}
+
+	listener := dyno.SeccompListener()
+	if listener == nil {
+		t.Fatal("want seccomp listener")
+	}
+
+	lerrc := make(chan error, 1)
+	go func() { lerrc <- listener.Run() }()
+
+	if want, got := (ExitStatus{}), dyno.Run(); want != got {
 		t.Fatalf("want exit code %q, got %q", want, got)
 	}
+
+	listener.Stop(nil)
+	if err := <-lerrc; err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]uint64)
+	for _, sc := range dyno.SeccompAudit().Syscalls {
+		counts[sc.Name] += sc.Count
+	}
+	for _, name := range []string{"openat", "mkdir"} {
+		if counts[name] == 0 {
+			t.Errorf("want %s syscall to be audited, got %v", name, counts)
+		}
+	}
+	if counts["prctl"] != 0 {
+		t.Errorf("want syscalls of the supervising thread to be ignored, got %v", counts)
+	}
 }
 
 func TestDynoCapabilities(t *testing.T) {
@@ -164,11 +297,172 @@ func TestDynoCapabilities(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	if want, got := ExitCode(0), <-errc; want != got {
+	if want, got := (ExitStatus{}), <-errc; want != got {
+		t.Fatalf("want exit code %q, got %q", want, got)
+	}
+}
+
+func TestDynoCapabilitiesUpperWord(t *testing.T) {
+	pr, pw := io.Pipe()
+
+	capMask := int64(1<<capChown) | int64(1<<capSysPtrace) | int64(1<<capSyslog) | int64(1<<capAuditRead)
+
+	dyno := &Dyno{
+		CommandLine: []string{
+			"/bin/bash", "-c",
+			`cat /proc/self/status`,
+		},
+
+		Capabilities: []string{
+			"CAP_AUDIT_READ",
+			"CAP_CHOWN",
+			"CAP_SYSLOG",
+			"CAP_SYS_PTRACE",
+		},
+
+		Stdout: pw,
+		Stderr: pw,
+	}
+
+	if err := dyno.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		errc <- dyno.Run()
+	}()
+
+	data, err := ioutil.ReadAll(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sets int
+
+	scanner := bufio.NewScanner(bytes.NewBuffer(data))
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "Cap") {
+			mask, err := strconv.ParseInt(line[8:], 16, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if want, got := capMask, mask; want != got {
+				t.Errorf("want %s mask %x, got %x", line[:6], want, got)
+			}
+			sets++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// CapInh, CapPrm, CapEff, CapBnd & CapAmb
+	if want, got := 5, sets; want != got {
+		t.Errorf("want %d capability sets, got %d", want, got)
+	}
+
+	if want, got := (ExitStatus{}), <-errc; want != got {
+		t.Fatalf("want exit code %q, got %q", want, got)
+	}
+}
+
+func TestDynoCapabilitySets(t *testing.T) {
+	pr, pw := io.Pipe()
+
+	dyno := &Dyno{
+		CommandLine: []string{
+			"/bin/bash", "-c",
+			`cat /proc/self/status`,
+		},
+
+		CapabilitySets: &CapabilitySets{
+			Inheritable: []string{"CAP_KILL"},
+			Ambient:     []string{"CAP_KILL"},
+			Bounding:    []string{"CAP_KILL", "CAP_NET_BIND_SERVICE"},
+			NoNewPrivs:  true,
+		},
+
+		Stdout: pw,
+		Stderr: pw,
+	}
+
+	if err := dyno.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		errc <- dyno.Run()
+	}()
+
+	data, err := ioutil.ReadAll(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	capMasks := map[string]int64{
+		"CapInh": int64(1 << capKill),
+		"CapAmb": int64(1 << capKill),
+		"CapBnd": int64(1<<capKill) | int64(1<<capNetBindService),
+	}
+
+	var noNewPrivs string
+
+	scanner := bufio.NewScanner(bytes.NewBuffer(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "NoNewPrivs:\t") {
+			noNewPrivs = line[12:]
+		}
+
+		capMask, ok := capMasks[strings.SplitN(line, ":", 2)[0]]
+		if !ok {
+			continue
+		}
+
+		mask, err := strconv.ParseInt(line[8:], 16, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if want, got := capMask, mask; want != got {
+			t.Errorf("want %s mask %x, got %x", line[:6], want, got)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := "1", noNewPrivs; want != got {
+		t.Errorf("want no_new_privs %q, got %q", want, got)
+	}
+
+	if want, got := (ExitStatus{}), <-errc; want != got {
 		t.Fatalf("want exit code %q, got %q", want, got)
 	}
 }
 
+func TestDynoUnknownCapability(t *testing.T) {
+	dyno := &Dyno{
+		CommandLine: []string{
+			"/bin/true",
+		},
+
+		Capabilities: []string{
+			"CAP_KILL",
+			"CAP_BOGUS",
+		},
+	}
+
+	if err := dyno.Start(); err == nil {
+		t.Fatal("want error for unknown capability")
+	}
+}
+
 func TestDynoUIDGID(t *testing.T) {
 	pr, pw := io.Pipe()
 
@@ -192,7 +486,7 @@ func TestDynoUIDGID(t *testing.T) {
 	go func() {
 		defer close(errc)
 
-		if want, got := ExitCode(0), dyno.Run(); want != got {
+		if want, got := (ExitStatus{}), dyno.Run(); want != got {
 			errc <- errors.Errorf("want dyno to exit %q, got %q", want, got)
 		}
 	}()
@@ -233,7 +527,7 @@ func TestDynoProcHidepidFlag(t *testing.T) {
 	go func() {
 		defer close(errc)
 
-		if want, got := ExitCode(0), dyno.Run(); want != got {
+		if want, got := (ExitStatus{}), dyno.Run(); want != got {
 			errc <- errors.Errorf("want dyno to exit %q, got %q", want, got)
 		}
 	}()
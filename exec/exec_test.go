@@ -42,7 +42,7 @@ func TestDynoStop(t *testing.T) {
 	}
 
 	dyno.Stop(nil)
-	if want, got := ExitCode(syscall.SIGTERM), dyno.Run(); want != got {
+	if want, got := (ExitStatus{Signal: syscall.SIGTERM}), dyno.Run(); want != got {
 		t.Fatalf("want stopped dyno to exit %q, got %q", want, got)
 	}
 }
@@ -69,8 +69,8 @@ func TestDynoOutput(t *testing.T) {
 	if err := dyno.Start(); err != nil {
 		t.Fatal(err)
 	}
-	if want, got := ExitCode(0), dyno.Run(); want != got {
-		t.Errorf("want exit code %d, got %d", want, got)
+	if want, got := (ExitStatus{}), dyno.Run(); want != got {
+		t.Errorf("want exit status %q, got %q", want, got)
 	}
 
 	if want, got := "hello\n", <-outc; want != got {
@@ -113,7 +113,7 @@ func TestDynoEnv(t *testing.T) {
 	}
 	env := string(buf)
 
-	if err := <-errc; err != ExitCode(0) {
+	if err := <-errc; err != (ExitStatus{}) {
 		t.Fatal(err)
 	}
 
@@ -140,7 +140,7 @@ func TestDynoSignalForwarding(t *testing.T) {
 	}
 
 	syscall.Kill(syscall.Getpid(), syscall.SIGINT)
-	if want, got := ExitCode(syscall.SIGINT), dyno.Run(); want != got {
+	if want, got := (ExitStatus{Signal: syscall.SIGINT}), dyno.Run(); want != got {
 		t.Fatalf("want signal forwarded dyno to exit %q, got %q", want, got)
 	}
 }
@@ -173,7 +173,124 @@ func TestDynoGracefulShutdown(t *testing.T) {
 
 	syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
 
-	if want, got := ExitCode(syscall.SIGKILL), dyno.Run(); want != got {
+	if want, got := (ExitStatus{Signal: syscall.SIGKILL}), dyno.Run(); want != got {
 		t.Fatalf("want graceful shutdown dyno to exit %q, got %q", want, got)
 	}
 }
+
+func TestDynoEvents(t *testing.T) {
+	pr, pw := io.Pipe()
+
+	dyno := &Dyno{
+		CommandLine: []string{
+			"/bin/bash", "-c",
+			"trap '' SIGTERM ; echo 'trap initialized' ; sleep 10",
+		},
+
+		ShutdownPeriod: 10 * time.Millisecond,
+		Stdout:         pw,
+	}
+
+	events := make(chan Event, 8)
+	dyno.Notify(events)
+
+	if err := dyno.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 128)
+	if _, err := pr.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dyno.Stop(nil)
+	err := dyno.Run()
+
+	want := []Event{
+		{Type: EventStarted},
+		{Type: EventSignaled, Signal: syscall.SIGTERM},
+		{Type: EventShutdown, Period: 10 * time.Millisecond},
+		{Type: EventKilled, Signal: syscall.SIGKILL, Period: 10 * time.Millisecond},
+		{Type: EventExited, Err: err},
+	}
+	for _, w := range want {
+		e := <-events
+		if w.Type == EventStarted {
+			if e.Pid == 0 {
+				t.Errorf("want pid of started event")
+			}
+			w.Pid = e.Pid
+		}
+		if e.Time.IsZero() {
+			t.Errorf("want time of %s event", e.Type)
+		}
+		e.Time = time.Time{}
+
+		if !reflect.DeepEqual(w, e) {
+			t.Errorf("want event %+v, got %+v", w, e)
+		}
+	}
+}
+
+func TestEventString(t *testing.T) {
+	tests := []struct {
+		event Event
+		want  string
+	}{
+		{Event{Type: EventStarted, Pid: 42}, "Starting process with pid 42"},
+		{Event{Type: EventSignaled, Signal: syscall.SIGTERM}, "Stopping all processes with SIGTERM"},
+		{Event{Type: EventSignaled, Signal: syscall.SIGHUP}, "Forwarding SIGHUP to all processes"},
+		{Event{Type: EventShutdown, Period: 30 * time.Second}, "Waiting 30s for processes to exit"},
+		{Event{Type: EventExited, Err: ExitStatus{Code: 1}}, "Process exited with status 1"},
+		{Event{Type: EventExited, Err: ExitStatus{Signal: syscall.SIGKILL}}, "Process exited with status 137 (killed by signal 9)"},
+	}
+
+	for _, test := range tests {
+		if got := test.event.String(); test.want != got {
+			t.Errorf("want %q, got %q", test.want, got)
+		}
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	tests := []struct {
+		ws     syscall.WaitStatus
+		status ExitStatus
+		code   int
+		err    string
+	}{
+		{0, ExitStatus{}, 0, "exit 0"},
+		{0x100, ExitStatus{Code: 1}, 1, "exit 1"},
+		{syscall.WaitStatus(syscall.SIGKILL), ExitStatus{Signal: syscall.SIGKILL}, 137, "killed by signal 9"},
+		{0x80 | syscall.WaitStatus(syscall.SIGSEGV), ExitStatus{Signal: syscall.SIGSEGV, CoreDumped: true}, 139, "killed by signal 11, core dumped"},
+	}
+
+	for _, test := range tests {
+		status := exitStatus(test.ws)
+		if want, got := test.status, status; want != got {
+			t.Errorf("%#x: want status %+v, got %+v", int(test.ws), want, got)
+		}
+		if want, got := test.code, status.ExitCode(); want != got {
+			t.Errorf("%#x: want exit code %d, got %d", int(test.ws), want, got)
+		}
+		if want, got := test.err, status.Error(); want != got {
+			t.Errorf("%#x: want error %q, got %q", int(test.ws), want, got)
+		}
+	}
+}
+
+func TestCheckLastCapability(t *testing.T) {
+	mask, err := capabilityMask([]string{"CAP_KILL", "CAP_CHECKPOINT_RESTORE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkLastCapability(mask, capTable["CAP_CHECKPOINT_RESTORE"]); err != nil {
+		t.Errorf("want no error, got %v", err)
+	}
+
+	err = checkLastCapability(mask, capTable["CAP_BPF"])
+	if want := "exec: capability unsupported by the kernel: CAP_CHECKPOINT_RESTORE"; err == nil || err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+}
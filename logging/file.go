@@ -0,0 +1,64 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// fileSink writes messages to a local file, one line per message.
+type fileSink struct {
+	*counters
+
+	w      io.Writer
+	closer io.Closer
+
+	buf bytes.Buffer
+}
+
+func openFileSink(path string, c *counters) (*fileSink, error) {
+	if path == "" {
+		return nil, fmt.Errorf("logging: missing file sink path")
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{counters: c, w: f, closer: f}, nil
+}
+
+func newStdSink(name string, c *counters) *fileSink {
+	if name == "stderr" {
+		return &fileSink{counters: c, w: os.Stderr}
+	}
+	return &fileSink{counters: c, w: os.Stdout}
+}
+
+// Write implements Sink.
+func (s *fileSink) Write(m Message) error {
+	s.buf.Reset()
+	fmt.Fprintf(&s.buf, "%s %s[%s]: %s\n",
+		m.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		nilValue(m.AppName),
+		nilValue(m.ProcID),
+		m.Text,
+	)
+
+	if _, err := s.w.Write(s.buf.Bytes()); err != nil {
+		s.drop(1)
+		s.failed(err)
+		return err
+	}
+	s.delivered()
+	return nil
+}
+
+// Close implements Sink.
+func (s *fileSink) Close() error {
+	if s.closer != nil {
+		return s.closer.Close()
+	}
+	return nil
+}
@@ -1,58 +1,329 @@
 package logging
 
 import (
+	"bufio"
 	"io"
 	"log"
-	"os"
-
-	shuttle "github.com/heroku/log-shuttle"
+	"sync"
+	"time"
 )
 
-// Forwarder sends logline data to a remote logging service. Only
-// Logplex/log-shuttle style logdrain services are currently supported.
+// MaxLineLength is the length of the longest forwarded line. Longer lines are
+// split into several messages.
+const MaxLineLength = 10000
+
+// FailureFlushTimeout bounds the flush of the sinks of a forwarder failed by
+// its error policy.
+const FailureFlushTimeout = 5 * time.Second
+
+// Forwarder sends logline data to remote logging services. Each line is
+// delivered to the sinks of all LogdrainURLs, see OpenSink.
 type Forwarder struct {
-	LogdrainURL string
-	// TODO: OtherServiceURL string
+	LogdrainURLs []string
 
 	AppName, AppID string
 	ProcessID      string
 
-	rcs   []io.ReadCloser
-	donec chan struct{}
+	// ErrorPolicy handles the delivery errors of the sinks. With the
+	// FailOnErrors policy, Run returns a *DeliveryError once a sink has
+	// failed FailureThreshold consecutive deliveries, or
+	// DefaultFailureThreshold if zero.
+	ErrorPolicy      ErrorPolicy
+	FailureThreshold int
+
+	// Spool, if not nil, buffers the messages of the network sinks on disk
+	// until they are delivered.
+	Spool *Spool
+
+	// RateLimit, if not nil, limits the lines of all streams. The lines over
+	// the limit are dropped, and noticed in their stream.
+	RateLimit *RateLimit
+
+	// DebugSampling forwards one of every DebugSampling debug lines, if
+	// greater than 1. Debug lines are the lines of debug streams, and the
+	// structured lines with a debug level field.
+	DebugSampling int
+
+	// Redaction, if not nil, redacts the secrets of the lines before they
+	// are forwarded.
+	Redaction *Redaction
+
+	streams []*stream
+	donec   chan struct{}
+	errc    chan error
+
+	redactor *redactor
+
+	mu      sync.Mutex
+	sinks   []countedSink
+	limiter *limiter
+	failed  bool
+}
+
+// stream is a forwarded reader. Its counters are guarded by the mutex of the
+// forwarder.
+type stream struct {
+	Stream
+	rc io.ReadCloser
+
+	system bool
+
+	stats      StreamStats
+	limited    uint64
+	debugLines uint64
 }
 
-// Forward sends loglines read from rc to a logging service.
+// Forward sends loglines read from rc to the logging services.
 func (f *Forwarder) Forward(rc io.ReadCloser) {
+	f.ForwardStream(rc, Stream{})
+}
+
+// ForwardStream sends loglines read from rc to the logging services, with the
+// metadata of s.
+func (f *Forwarder) ForwardStream(rc io.ReadCloser, s Stream) {
 	if f.donec == nil {
 		f.donec = make(chan struct{})
+		f.errc = make(chan error, 1)
 	}
 
-	f.rcs = append(f.rcs, rc)
+	if s.ProcID == "" {
+		s.ProcID = f.ProcessID
+	}
+	f.streams = append(f.streams, &stream{
+		Stream: s,
+		rc:     rc,
+		stats:  StreamStats{ProcID: s.ProcID},
+	})
 }
 
-// Run forwards logs to a logging service.
+// SystemProcID is the procid of the system lines of a forwarder.
+const SystemProcID = "dynolab"
+
+// ForwardSystem returns a writer of system lines, like the lifecycle events
+// of the dyno. System lines are forwarded with SystemProcID and notice
+// severity, and are not rate limited. The writer must be closed for Run to
+// return.
+func (f *Forwarder) ForwardSystem() io.WriteCloser {
+	r, w := io.Pipe()
+	f.ForwardStream(r, Stream{ProcID: SystemProcID, Severity: SeverityNotice})
+	f.streams[len(f.streams)-1].system = true
+	return w
+}
+
+// Run forwards logs to the logging services. Once interrupted, Run returns
+// after all forwarded readers are read until EOF, and the sinks are flushed.
+//
+// If the error policy fails the forwarder, Run closes the sinks, waiting at
+// most FailureFlushTimeout for them to flush, and returns the error without
+// waiting for the readers: they are read until EOF, and their lines
+// discarded.
 func (f *Forwarder) Run() error {
-	cfg := shuttle.NewConfig()
-	cfg.LogsURL = f.LogdrainURL
-	cfg.Appname = f.AppName
-	cfg.Hostname = f.AppID
-	cfg.Procid = f.ProcessID
-	cfg.ComputeHeader()
+	var multiline bool
+	for _, s := range f.streams {
+		multiline = multiline || s.Multiline != nil
+	}
 
-	ls := shuttle.NewShuttle(cfg)
-	for _, rc := range f.rcs {
-		ls.LoadReader(rc)
+	sinks := make([]countedSink, 0, len(f.LogdrainURLs))
+	for _, rawurl := range f.LogdrainURLs {
+		var spool *Spool
+		if f.Spool != nil {
+			sp := *f.Spool
+			sp.Dir = spoolDir(sp.Dir, f.AppID, f.ProcessID, rawurl)
+			spool = &sp
+		}
+
+		sink, err := openSink(rawurl, f.report, spool, multiline)
+		if err != nil {
+			for _, sink := range sinks {
+				sink.Close()
+			}
+			return err
+		}
+		sinks = append(sinks, sink)
 	}
 
-	// TODO: wire up ls.ErrLogger, parse & return log-shuttle error
-	ls.ErrLogger = log.New(os.Stdout, "log-shuttle", 0)
+	if f.Redaction != nil {
+		f.redactor = newRedactor(*f.Redaction)
+	}
+
+	f.mu.Lock()
+	f.sinks = sinks
+	if f.RateLimit != nil {
+		f.limiter = newLimiter(*f.RateLimit, time.Now())
+	}
+	f.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, s := range f.streams {
+		wg.Add(1)
+		go func(s *stream) {
+			defer wg.Done()
+			f.read(s)
+		}(s)
+	}
 
-	ls.Launch()
-	<-f.donec
-	ls.Land()
+	select {
+	case <-f.donec:
+	case err := <-f.errc:
+		f.mu.Lock()
+		f.failed = true
+		f.mu.Unlock()
 
+		closeSinks(sinks, FailureFlushTimeout)
+		return err
+	}
+	wg.Wait()
+
+	closeSinks(sinks, 0)
 	return nil
 }
 
+// closeSinks closes the sinks, waiting at most timeout for them to flush if
+// it is greater than zero.
+func closeSinks(sinks []countedSink, timeout time.Duration) {
+	donec := make(chan struct{})
+	go func() {
+		defer close(donec)
+
+		var wg sync.WaitGroup
+		for _, sink := range sinks {
+			wg.Add(1)
+			go func(sink countedSink) {
+				defer wg.Done()
+				if err := sink.Close(); err != nil {
+					log.Printf("logging: %v", err)
+				}
+			}(sink)
+		}
+		wg.Wait()
+	}()
+
+	if timeout <= 0 {
+		<-donec
+		return
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case <-donec:
+	case <-t.C:
+		log.Printf("logging: sinks not flushed within %s", timeout)
+	}
+}
+
+// Stats returns the delivery counters of the sinks.
+func (f *Forwarder) Stats() []SinkStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := make([]SinkStats, 0, len(f.sinks))
+	for _, sink := range f.sinks {
+		stats = append(stats, sink.stats())
+	}
+	return stats
+}
+
+// StreamStats returns the counters of the forwarded streams.
+func (f *Forwarder) StreamStats() []StreamStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := make([]StreamStats, 0, len(f.streams))
+	for _, s := range f.streams {
+		stats = append(stats, s.stats)
+	}
+	return stats
+}
+
+// report applies the error policy to the delivery failures of a sink.
+func (f *Forwarder) report(sink string, err error, failures int) {
+	if f.ErrorPolicy == IgnoreErrors {
+		return
+	}
+	log.Printf("logging: %s: %v", sink, err)
+
+	threshold := f.FailureThreshold
+	if threshold <= 0 {
+		threshold = DefaultFailureThreshold
+	}
+	if f.ErrorPolicy == FailOnErrors && failures >= threshold {
+		select {
+		case f.errc <- &DeliveryError{Sink: sink, Failures: failures, Err: err}:
+		default:
+		}
+	}
+}
+
 // Stop interrupts f.
 func (f *Forwarder) Stop(err error) { close(f.donec) }
+
+// read sends the lines of s to the sinks, until EOF.
+func (f *Forwarder) read(s *stream) {
+	defer s.rc.Close()
+	defer f.notice(s)
+
+	write := func(text string) { f.write(s, text) }
+	if s.Multiline != nil {
+		agg := newAggregator(*s.Multiline, write)
+		defer agg.close()
+		write = agg.add
+	}
+
+	br := bufio.NewReaderSize(s.rc, MaxLineLength)
+	for {
+		line, err := br.ReadSlice('\n')
+		if len(line) > 0 {
+			if line[len(line)-1] == '\n' {
+				line = line[:len(line)-1]
+			}
+			write(string(line))
+		}
+
+		switch err {
+		case nil, bufio.ErrBufferFull:
+		case io.EOF:
+			return
+		default:
+			log.Printf("logging: %v", err)
+			return
+		}
+	}
+}
+
+func (f *Forwarder) write(s *stream, text string) {
+	var redactions int
+	if f.redactor != nil {
+		text, redactions = f.redactor.redact(text)
+	}
+
+	m := Message{
+		Time:     time.Now(),
+		Hostname: f.AppID,
+		AppName:  f.AppName,
+		ProcID:   s.ProcID,
+		Severity: s.Severity,
+		Text:     text,
+	}
+	if s.Structured {
+		m.Data = parseStructured(text)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s.stats.Redactions += uint64(redactions)
+	if f.failed || !f.limit(s, m) {
+		return
+	}
+	f.send(m)
+}
+
+// send writes m to the sinks. The mutex of f must be held.
+func (f *Forwarder) send(m Message) {
+	// delivery errors are counted and reported by the sinks.
+	for _, sink := range f.sinks {
+		sink.Write(m)
+	}
+}
@@ -0,0 +1,137 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// httpTimeout bounds the post of a batch.
+const httpTimeout = 10 * time.Second
+
+// httpSink posts batches of messages to an HTTP endpoint, as a JSON array,
+// or as RFC 6587 frames of RFC 5424 messages to a Logplex logdrain.
+type httpSink struct {
+	*queue
+
+	url     string
+	client  *http.Client
+	logplex bool
+}
+
+// jsonMessage is the JSON representation of a Message.
+type jsonMessage struct {
+	Time     time.Time         `json:"time"`
+	Hostname string            `json:"hostname,omitempty"`
+	AppName  string            `json:"app,omitempty"`
+	ProcID   string            `json:"procid,omitempty"`
+	Severity string            `json:"severity"`
+	Data     map[string]string `json:"data,omitempty"`
+	Text     string            `json:"msg"`
+}
+
+func newHTTPSink(u *url.URL, c *counters, spool *Spool) (*httpSink, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("logging: missing host in %s sink URL", u.Scheme)
+	}
+
+	target := *u
+	target.Scheme = strings.TrimPrefix(u.Scheme, "json+")
+
+	s := &httpSink{
+		url:     target.String(),
+		client:  &http.Client{Timeout: httpTimeout},
+		logplex: !strings.HasPrefix(u.Scheme, "json+"),
+	}
+	q, err := newQueue(c, spool, s.deliver)
+	if err != nil {
+		return nil, err
+	}
+	s.queue = q
+	return s, nil
+}
+
+func (s *httpSink) deliver(batch []Message) (int, error) {
+	var body []byte
+	contentType := "application/json"
+	if s.logplex {
+		contentType = "application/logplex-1"
+		for _, m := range batch {
+			body = appendFrame(body, formatSyslog(nil, m))
+		}
+	} else {
+		var err error
+		if body, err = encodeJSON(batch); err != nil {
+			return 0, err
+		}
+	}
+
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.logplex {
+		req.Header.Set("Logplex-Msg-Count", strconv.Itoa(len(batch)))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return 0, &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+	return len(batch), nil
+}
+
+// statusError is the error of a post answered with an unexpected status.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %q", e.status)
+}
+
+// permanent reports whether err is the rejection of a post, which fails again
+// if retried: a client error other than a timeout or rate limiting.
+func permanent(err error) bool {
+	serr, ok := err.(*statusError)
+	if !ok || serr.code/100 != 4 {
+		return false
+	}
+	return serr.code != http.StatusRequestTimeout && serr.code != http.StatusTooManyRequests
+}
+
+// encodeJSON returns the JSON array of the messages of batch.
+func encodeJSON(batch []Message) ([]byte, error) {
+	msgs := make([]jsonMessage, 0, len(batch))
+	for _, m := range batch {
+		msg := jsonMessage{
+			Time:     m.Time,
+			Hostname: m.Hostname,
+			AppName:  m.AppName,
+			ProcID:   m.ProcID,
+			Severity: m.Severity.String(),
+			Text:     m.Text,
+		}
+		if len(m.Data) > 0 {
+			msg.Data = make(map[string]string, len(m.Data))
+			for _, p := range m.Data {
+				msg.Data[p.Name] = p.Value
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return json.Marshal(msgs)
+}
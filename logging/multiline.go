@@ -0,0 +1,141 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default multiline bounds.
+const (
+	DefaultMultilineMaxLines     = 200
+	DefaultMultilineFlushTimeout = 250 * time.Millisecond
+)
+
+// Patterns of the continuation lines of stack traces.
+var (
+	// JavaContinuation matches the frames, omitted frames and causes of
+	// Java exceptions.
+	JavaContinuation = regexp.MustCompile(`^\s+at\s|^\s+\.\.\. \d+ (?:more|common frames omitted)$|^Caused by:|^\s+Suppressed:`)
+
+	// RubyContinuation matches the frames of Ruby backtraces.
+	RubyContinuation = regexp.MustCompile(`^\s+from\s|^\s+\S+:\d+:in\s`)
+
+	// IndentedContinuation matches indented lines.
+	IndentedContinuation = regexp.MustCompile(`^\s`)
+)
+
+// LanguageContinuation returns the continuation pattern of a language: java,
+// ruby or indented.
+func LanguageContinuation(lang string) (*regexp.Regexp, error) {
+	switch lang {
+	case "java":
+		return JavaContinuation, nil
+	case "ruby":
+		return RubyContinuation, nil
+	case "indented":
+		return IndentedContinuation, nil
+	default:
+		return nil, fmt.Errorf("logging: unknown multiline language %q", lang)
+	}
+}
+
+// Multiline configures the aggregation of continuation lines, like the frames
+// of stack traces, into the message of the line they continue. The lines of
+// a message are separated by newlines, and the message is delivered whole:
+// the Logplex logdrains of a forwarder with multiline streams are posted to
+// directly, with octet counting framing, rather than through log-shuttle.
+type Multiline struct {
+	// Patterns match continuation lines.
+	Patterns []*regexp.Regexp
+
+	// MaxLines bounds the lines of a message, or DefaultMultilineMaxLines
+	// if zero. Messages are also bounded by MaxLineLength.
+	MaxLines int
+
+	// FlushTimeout is the delay after which a message is forwarded if no
+	// continuation line is read, or DefaultMultilineFlushTimeout if zero.
+	FlushTimeout time.Duration
+}
+
+// aggregator joins continuation lines, and flushes the messages.
+type aggregator struct {
+	Multiline
+	flush func(text string)
+
+	mu    sync.Mutex
+	lines []string
+	size  int
+	timer *time.Timer
+}
+
+func newAggregator(ml Multiline, flush func(text string)) *aggregator {
+	if ml.MaxLines <= 0 {
+		ml.MaxLines = DefaultMultilineMaxLines
+	}
+	if ml.FlushTimeout <= 0 {
+		ml.FlushTimeout = DefaultMultilineFlushTimeout
+	}
+	return &aggregator{Multiline: ml, flush: flush}
+}
+
+// add adds line to the pending message if it continues it, or flushes the
+// pending message and starts a new one.
+func (a *aggregator) add(line string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if len(a.lines) == 0 || !a.continues(line) ||
+		len(a.lines) >= a.MaxLines || a.size+1+len(line) > MaxLineLength {
+		a.flushLocked()
+	}
+
+	a.lines = append(a.lines, line)
+	a.size += len(line)
+	if len(a.lines) > 1 {
+		a.size++
+	}
+
+	if a.timer == nil {
+		a.timer = time.AfterFunc(a.FlushTimeout, a.timeout)
+	} else {
+		a.timer.Reset(a.FlushTimeout)
+	}
+}
+
+func (a *aggregator) continues(line string) bool {
+	for _, re := range a.Patterns {
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *aggregator) timeout() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.flushLocked()
+}
+
+func (a *aggregator) flushLocked() {
+	if len(a.lines) == 0 {
+		return
+	}
+	a.flush(strings.Join(a.lines, "\n"))
+	a.lines, a.size = a.lines[:0], 0
+}
+
+// close flushes the pending message.
+func (a *aggregator) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	a.flushLocked()
+}
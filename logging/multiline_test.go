@@ -0,0 +1,138 @@
+package logging
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAggregator(t *testing.T) {
+	var msgs []string
+	a := newAggregator(Multiline{
+		Patterns:     []*regexp.Regexp{JavaContinuation, RubyContinuation},
+		MaxLines:     3,
+		FlushTimeout: time.Hour,
+	}, func(text string) { msgs = append(msgs, text) })
+
+	lines := []string{
+		`Exception in thread "main" java.lang.IllegalStateException: boom`,
+		"\tat com.example.App.run(App.java:12)",
+		"Caused by: java.lang.NullPointerException",
+		"\t... 3 more",
+		"hello",
+		"app.rb:3:in `foo': boom (RuntimeError)",
+		"\tfrom app.rb:7:in `<main>'",
+	}
+	for _, line := range lines {
+		a.add(line)
+	}
+	a.close()
+
+	want := []string{
+		strings.Join(lines[:3], "\n"),
+		lines[3],
+		lines[4],
+		strings.Join(lines[5:], "\n"),
+	}
+	if !reflect.DeepEqual(want, msgs) {
+		t.Errorf("want messages %q, got %q", want, msgs)
+	}
+}
+
+func TestAggregatorTimeout(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		msgs []string
+	)
+	a := newAggregator(Multiline{
+		Patterns:     []*regexp.Regexp{IndentedContinuation},
+		FlushTimeout: 10 * time.Millisecond,
+	}, func(text string) {
+		mu.Lock()
+		defer mu.Unlock()
+		msgs = append(msgs, text)
+	})
+	defer a.close()
+
+	a.add("panic: boom")
+	a.add("  main.main()")
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(msgs)
+		mu.Unlock()
+		if n > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"panic: boom\n  main.main()"}; !reflect.DeepEqual(want, msgs) {
+		t.Errorf("want messages %q, got %q", want, msgs)
+	}
+}
+
+func TestLanguageContinuation(t *testing.T) {
+	for _, lang := range []string{"java", "ruby", "indented"} {
+		if _, err := LanguageContinuation(lang); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err := LanguageContinuation("cobol"); err == nil {
+		t.Error("want error")
+	}
+}
+
+func TestForwarderMultilineLogplex(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		body []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want, got := "application/logplex-1", r.Header.Get("Content-Type"); want != got {
+			t.Errorf("want content type %q, got %q", want, got)
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		body = append(body, b...)
+	}))
+	defer srv.Close()
+
+	f := &Forwarder{
+		LogdrainURLs: []string{srv.URL + "/logs"},
+		AppName:      "app",
+	}
+
+	// the stack trace is posted in a single frame, rather than split into
+	// lines by log-shuttle.
+	trace := "java.lang.IllegalStateException: boom\n\tat Main.main(Main.java:3)"
+	f.ForwardStream(ioutil.NopCloser(strings.NewReader(trace+"\n")), Stream{
+		ProcID:    "web.1",
+		Multiline: &Multiline{Patterns: []*regexp.Regexp{JavaContinuation}},
+	})
+
+	f.Stop(nil)
+	if err := f.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	frame := strings.SplitN(string(body), " ", 2)
+	if len(frame) != 2 || frame[0] != strconv.Itoa(len(frame[1])) || !strings.HasSuffix(frame[1], " - "+trace) {
+		t.Errorf("want a single frame of the stack trace, got %q", body)
+	}
+}
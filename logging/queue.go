@@ -0,0 +1,182 @@
+package logging
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// Default queue sizes of network sinks.
+const (
+	DefaultQueueSize = 10000
+	DefaultBatchSize = 500
+)
+
+// Bounds of the delay between the delivery attempts of spooled messages.
+const (
+	spoolMinRetryDelay = time.Second
+	spoolMaxRetryDelay = time.Minute
+)
+
+// queue delivers the messages written to a network sink in batches, from its
+// own goroutine. Messages written while the queue is full, and the messages
+// of a batch not delivered when its delivery fails, are dropped. Deliveries
+// return the number of messages delivered, in batch order.
+//
+// With a spool, messages are queued on disk, and failed deliveries are
+// retried, unless the batch is rejected by the destination.
+type queue struct {
+	*counters
+	deliver func([]Message) (int, error)
+
+	c     chan Message
+	spool *spool
+	stopc chan struct{}
+	donec chan struct{}
+}
+
+func newQueue(c *counters, spool *Spool, deliver func([]Message) (int, error)) (*queue, error) {
+	q := &queue{
+		counters: c,
+		deliver:  deliver,
+		donec:    make(chan struct{}),
+	}
+
+	if spool == nil {
+		q.c = make(chan Message, DefaultQueueSize)
+		go q.run()
+		return q, nil
+	}
+
+	sp, err := openSpool(*spool)
+	if err != nil {
+		return nil, err
+	}
+	q.spool = sp
+	q.stopc = make(chan struct{})
+	go q.replay()
+	return q, nil
+}
+
+// Write implements Sink.
+func (q *queue) Write(m Message) error {
+	if q.spool != nil {
+		if err := q.spool.write(m); err != nil {
+			q.drop(1)
+			if err != errSpoolFull {
+				q.failed(err)
+			}
+		}
+		return nil
+	}
+
+	select {
+	case q.c <- m:
+	default:
+		q.drop(1)
+	}
+	return nil
+}
+
+// Close delivers the queued messages, and stops the queue. Spooled messages
+// are left on disk if their delivery fails.
+func (q *queue) Close() error {
+	if q.spool == nil {
+		close(q.c)
+		<-q.donec
+		return nil
+	}
+
+	q.spool.stop()
+	close(q.stopc)
+	<-q.donec
+	return q.spool.close()
+}
+
+// stats adds the spool counters to the sink counters.
+func (q *queue) stats() SinkStats {
+	stats := q.counters.stats()
+	if q.spool != nil {
+		stats.Spooled, stats.SpoolDropped = q.spool.stats()
+	}
+	return stats
+}
+
+func (q *queue) run() {
+	defer close(q.donec)
+
+	batch := make([]Message, 0, DefaultBatchSize)
+	for m := range q.c {
+		batch = append(batch[:0], m)
+
+	fill:
+		for len(batch) < DefaultBatchSize {
+			select {
+			case m, ok := <-q.c:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, m)
+			default:
+				break fill
+			}
+		}
+
+		if n, err := q.deliver(batch); err != nil {
+			q.drop(uint64(len(batch) - n))
+			q.failed(err)
+		} else {
+			q.delivered()
+		}
+	}
+}
+
+// replay delivers the spooled messages in order, until the spool is stopped
+// and empty, or a delivery fails once stopped.
+func (q *queue) replay() {
+	defer close(q.donec)
+
+	delay := spoolMinRetryDelay
+	for {
+		batch, ends, off, err := q.spool.next(DefaultBatchSize)
+		if err == io.EOF {
+			return
+		}
+		var n int
+		if err == nil && len(batch) > 0 {
+			n, err = q.deliver(batch)
+		}
+
+		if err != nil {
+			if n > 0 {
+				q.spool.ack(ends[n-1])
+			}
+			q.failed(err)
+
+			// retrying a rejected batch would block the spool.
+			if permanent(err) {
+				q.drop(uint64(len(batch) - n))
+				q.spool.ack(off)
+				delay = spoolMinRetryDelay
+				continue
+			}
+
+			select {
+			case <-q.stopc:
+				log.Printf("logging: %s: messages left in spool", q.name)
+				return
+			case <-time.After(delay):
+			}
+			if delay *= 2; delay > spoolMaxRetryDelay {
+				delay = spoolMaxRetryDelay
+			}
+			continue
+		}
+
+		delay = spoolMinRetryDelay
+		q.spool.ack(off)
+		if len(batch) > 0 {
+			q.delivered()
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RateLimit configures the token buckets limiting the lines of a dyno.
+type RateLimit struct {
+	// LinesPerSecond and BytesPerSecond are the sustained rates of the
+	// lines, unlimited if zero.
+	LinesPerSecond float64
+	BytesPerSecond float64
+
+	// LineBurst and ByteBurst are the sizes of the buckets, or a second of
+	// their rate if zero.
+	LineBurst int
+	ByteBurst int
+}
+
+// limiter is a pair of token buckets, of lines and bytes.
+type limiter struct {
+	lines, bytes bucket
+}
+
+type bucket struct {
+	rate, size float64
+	tokens     float64
+	last       time.Time
+}
+
+func newLimiter(rl RateLimit, now time.Time) *limiter {
+	return &limiter{
+		lines: newBucket(rl.LinesPerSecond, rl.LineBurst, now),
+		bytes: newBucket(rl.BytesPerSecond, rl.ByteBurst, now),
+	}
+}
+
+func newBucket(rate float64, burst int, now time.Time) bucket {
+	size := float64(burst)
+	if size <= 0 {
+		size = rate
+	}
+	return bucket{rate: rate, size: size, tokens: size, last: now}
+}
+
+// allow takes a line of n bytes from the buckets, or reports false if either
+// bucket lacks tokens.
+func (l *limiter) allow(n int, now time.Time) bool {
+	l.lines.fill(now)
+	l.bytes.fill(now)
+
+	if !l.lines.has(1) || !l.bytes.has(float64(n)) {
+		return false
+	}
+	l.lines.take(1)
+	l.bytes.take(float64(n))
+	return true
+}
+
+func (b *bucket) fill(now time.Time) {
+	if b.rate <= 0 {
+		return
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.size {
+			b.tokens = b.size
+		}
+	}
+	b.last = now
+}
+
+// has reports whether n tokens can be taken. Lines larger than the bucket
+// are allowed once it is full.
+func (b *bucket) has(n float64) bool {
+	if b.rate <= 0 {
+		return true
+	}
+	return b.tokens >= n || b.tokens >= b.size
+}
+
+func (b *bucket) take(n float64) {
+	if b.rate > 0 {
+		b.tokens -= n
+	}
+}
+
+// limit reports whether m is forwarded, after debug sampling and rate
+// limiting. The lines of s dropped by the rate limit are noticed before the
+// next forwarded line. The mutex of f must be held.
+func (f *Forwarder) limit(s *stream, m Message) bool {
+	if s.system {
+		return true
+	}
+
+	if f.DebugSampling > 1 && isDebug(m) {
+		s.debugLines++
+		if (s.debugLines-1)%uint64(f.DebugSampling) != 0 {
+			s.stats.Sampled++
+			return false
+		}
+	}
+
+	if f.limiter == nil {
+		return true
+	}
+	if !f.limiter.allow(len(m.Text), time.Now()) {
+		s.limited++
+		s.stats.RateLimited++
+		return false
+	}
+
+	f.sendNotice(s)
+	return true
+}
+
+// notice sends the notice of the lines of s dropped by the rate limit, if
+// any.
+func (f *Forwarder) notice(s *stream) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !f.failed {
+		f.sendNotice(s)
+	}
+}
+
+func (f *Forwarder) sendNotice(s *stream) {
+	if s.limited == 0 {
+		return
+	}
+
+	f.send(Message{
+		Time:     time.Now(),
+		Hostname: f.AppID,
+		AppName:  f.AppName,
+		ProcID:   s.ProcID,
+		Severity: SeverityWarning,
+		Text:     fmt.Sprintf("Error L10 (rate limit): %d lines dropped due to rate limit", s.limited),
+	})
+	s.limited = 0
+}
+
+// isDebug reports whether m is a debug line.
+func isDebug(m Message) bool {
+	if m.Severity == SeverityDebug {
+		return true
+	}
+	for _, p := range m.Data {
+		if (p.Name == "level" || p.Name == "severity") && strings.EqualFold(p.Value, "debug") {
+			return true
+		}
+	}
+	return false
+}
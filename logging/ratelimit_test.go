@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := newLimiter(RateLimit{LinesPerSecond: 2, BytesPerSecond: 100, ByteBurst: 10}, now)
+
+	tests := []struct {
+		after time.Duration
+		n     int
+		want  bool
+	}{
+		{0, 5, true},
+		{0, 5, true},
+		// both buckets are empty.
+		{0, 1, false},
+		// a line is taken from the bytes bucket after 10ms.
+		{10 * time.Millisecond, 1, false},
+		{500 * time.Millisecond, 1, true},
+		// lines larger than the bytes bucket are allowed once it is full.
+		{time.Second, 20, true},
+		{0, 1, false},
+		{150 * time.Millisecond, 1, true},
+	}
+
+	for i, test := range tests {
+		now = now.Add(test.after)
+		if got := l.allow(test.n, now); test.want != got {
+			t.Errorf("%d: want %t, got %t", i, test.want, got)
+		}
+	}
+}
+
+func TestForwarderRateLimit(t *testing.T) {
+	lines := forwardLines(t, &Forwarder{
+		RateLimit: &RateLimit{LinesPerSecond: 0.001, LineBurst: 2},
+	}, Stream{}, "a\nb\nc\nd\ne\n")
+
+	want := []string{
+		"a",
+		"b",
+		"Error L10 (rate limit): 3 lines dropped due to rate limit",
+	}
+	if !reflect.DeepEqual(want, lines) {
+		t.Errorf("want lines %q, got %q", want, lines)
+	}
+}
+
+func TestForwarderDebugSampling(t *testing.T) {
+	f := &Forwarder{DebugSampling: 3}
+	lines := forwardLines(t, f, Stream{Severity: SeverityDebug}, "1\n2\n3\n4\n5\n6\n7\n")
+
+	if want := []string{"1", "4", "7"}; !reflect.DeepEqual(want, lines) {
+		t.Errorf("want lines %q, got %q", want, lines)
+	}
+	if want, got := []StreamStats{{ProcID: "web.1", Sampled: 4}}, f.StreamStats(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want stats %+v, got %+v", want, got)
+	}
+
+	lines = forwardLines(t, &Forwarder{DebugSampling: 2}, Stream{Structured: true}, "level=debug n=1\nlevel=debug n=2\nlevel=info n=3\n")
+
+	if want := []string{"level=debug n=1", "level=info n=3"}; !reflect.DeepEqual(want, lines) {
+		t.Errorf("want lines %q, got %q", want, lines)
+	}
+}
+
+// forwardLines forwards data as a stream of f, and returns the text of the
+// forwarded lines.
+func forwardLines(t *testing.T, f *Forwarder, s Stream, data string) []string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dyno.log")
+	f.LogdrainURLs = []string{"file://" + path}
+	f.ProcessID = "web.1"
+	f.ForwardStream(ioutil.NopCloser(strings.NewReader(data)), s)
+
+	res := make(chan error)
+	go func() { res <- f.Run() }()
+	f.Stop(nil)
+
+	if err := <-res; err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(readFile(t, path), "\n"), "\n") {
+		lines = append(lines, line[strings.Index(line, ": ")+2:])
+	}
+	return lines
+}
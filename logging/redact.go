@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// DefaultRedactionReplacement replaces the redacted secrets.
+const DefaultRedactionReplacement = "[REDACTED]"
+
+// MinRedactedEnvLength is the length of the shortest redacted environment
+// value: shorter values, like DYNO=web.1, are unlikely to be secrets.
+const MinRedactedEnvLength = 8
+
+// Patterns of common secrets.
+var (
+	// CreditCardPattern matches Visa, Mastercard, American Express and
+	// Discover card numbers, optionally grouped by spaces or dashes.
+	CreditCardPattern = regexp.MustCompile(`\b(?:(?:4\d{3}|5[1-5]\d{2}|6011)(?:[ -]?\d{4}){3}|3[47]\d{2}[ -]?\d{6}[ -]?\d{5})\b`)
+
+	// BearerTokenPattern matches the token of bearer authorizations.
+	BearerTokenPattern = regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`)
+)
+
+// Redaction configures the redaction of the secrets of forwarded lines.
+type Redaction struct {
+	// Env is an environment, in the form key=value, whose values are
+	// redacted. Values shorter than MinRedactedEnvLength are not.
+	Env []string
+
+	// Patterns match secrets. The first submatch of the patterns with
+	// subexpressions is redacted, the whole match otherwise.
+	Patterns []*regexp.Regexp
+
+	// Replacement replaces the secrets, or DefaultRedactionReplacement if
+	// empty.
+	Replacement string
+}
+
+// redactor replaces the matches of patterns.
+type redactor struct {
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+func newRedactor(r Redaction) *redactor {
+	rd := &redactor{
+		patterns:    r.Patterns,
+		replacement: r.Replacement,
+	}
+	if rd.replacement == "" {
+		rd.replacement = DefaultRedactionReplacement
+	}
+
+	var values []string
+	for _, kv := range r.Env {
+		if i := strings.IndexByte(kv, '='); i >= 0 && len(kv)-i-1 >= MinRedactedEnvLength {
+			values = append(values, regexp.QuoteMeta(kv[i+1:]))
+		}
+	}
+	if len(values) > 0 {
+		// the longest values are matched first.
+		sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+		env := regexp.MustCompile(strings.Join(values, "|"))
+		rd.patterns = append([]*regexp.Regexp{env}, rd.patterns...)
+	}
+	return rd
+}
+
+// redact returns text with its secrets replaced, and the number of replaced
+// secrets.
+func (r *redactor) redact(text string) (string, int) {
+	var n int
+	for _, re := range r.patterns {
+		locs := re.FindAllStringSubmatchIndex(text, -1)
+		if locs == nil {
+			continue
+		}
+
+		var b strings.Builder
+		last := 0
+		for _, loc := range locs {
+			start, end := loc[0], loc[1]
+			if len(loc) > 2 {
+				if loc[2] < 0 {
+					continue
+				}
+				start, end = loc[2], loc[3]
+			}
+
+			b.WriteString(text[last:start])
+			b.WriteString(r.replacement)
+			last = end
+			n++
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+	}
+	return text, n
+}
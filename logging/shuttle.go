@@ -0,0 +1,228 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	shuttle "github.com/heroku/log-shuttle"
+)
+
+// shuttleSink delivers messages to a Logplex logdrain with log-shuttle. The
+// header of the lines is set by the shuttle configuration: a shuttle is
+// launched for each source and severity of the messages. Structured data is
+// not supported by log-shuttle.
+//
+// Deliveries are counted from the log-shuttle metrics every
+// shuttleCheckInterval: messages lost once log-shuttle has given up retrying
+// their post are a failed delivery, successful posts a delivery.
+type shuttleSink struct {
+	*counters
+
+	url string
+
+	mu           sync.Mutex
+	shuttles     map[shuttleSource]*shuttlePipe
+	posts, lost  uint64
+	stopc, donec chan struct{}
+}
+
+// shuttleCheckInterval is the interval between reads of the log-shuttle
+// metrics.
+const shuttleCheckInterval = time.Second
+
+// shuttlePostSuccess is the log-shuttle timer of the successful posts.
+const shuttlePostSuccess = "outlet.post.success"
+
+type shuttleSource struct {
+	hostname, appName, procID string
+	prival                    int
+}
+
+// shuttlePipe is a shuttle reading the lines of a pipe. Lines are queued
+// until written to the pipe, from its own goroutine: lines written while the
+// queue is full are dropped.
+type shuttlePipe struct {
+	ls    *shuttle.Shuttle
+	lines chan string
+	donec chan struct{}
+}
+
+func newShuttlePipe(ls *shuttle.Shuttle, w io.WriteCloser) *shuttlePipe {
+	p := &shuttlePipe{
+		ls:    ls,
+		lines: make(chan string, DefaultQueueSize),
+		donec: make(chan struct{}),
+	}
+	go p.run(w)
+	return p
+}
+
+// write queues the line, and reports whether the queue had room for it.
+func (p *shuttlePipe) write(line string) bool {
+	select {
+	case p.lines <- line:
+		return true
+	default:
+		return false
+	}
+}
+
+// close writes the queued lines, and closes the pipe.
+func (p *shuttlePipe) close() {
+	close(p.lines)
+	<-p.donec
+}
+
+func (p *shuttlePipe) run(w io.WriteCloser) {
+	defer close(p.donec)
+	defer w.Close()
+
+	for line := range p.lines {
+		// once the shuttle has closed the pipe, the lines are discarded.
+		io.WriteString(w, line)
+	}
+}
+
+func newShuttleSink(rawurl string, c *counters) *shuttleSink {
+	s := &shuttleSink{
+		counters: c,
+		url:      rawurl,
+		shuttles: make(map[shuttleSource]*shuttlePipe),
+		stopc:    make(chan struct{}),
+		donec:    make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write implements Sink.
+func (s *shuttleSink) Write(m Message) error {
+	src := shuttleSource{
+		hostname: m.Hostname,
+		appName:  m.AppName,
+		procID:   m.ProcID,
+		prival:   prival(m.Severity),
+	}
+
+	s.mu.Lock()
+	p, ok := s.shuttles[src]
+	if !ok {
+		p = s.launch(src)
+		s.shuttles[src] = p
+	}
+	s.mu.Unlock()
+
+	if !p.write(m.Text + "\n") {
+		s.drop(1)
+	}
+	return nil
+}
+
+// Close lands all shuttles, once they have read the written lines.
+func (s *shuttleSink) Close() error {
+	close(s.stopc)
+	<-s.donec
+
+	// no shuttle is launched once closed.
+	for _, p := range s.shuttles {
+		p.close()
+		p.ls.Land()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.check()
+	return nil
+}
+
+// stats adds the lines dropped and lost by the shuttles to the sink counters.
+func (s *shuttleSink) stats() SinkStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.counters.stats()
+	for _, p := range s.shuttles {
+		drops, _ := p.ls.Drops.Read()
+		lost, _ := p.ls.Lost.Read()
+		stats.Dropped += drops + lost
+	}
+	return stats
+}
+
+func (s *shuttleSink) run() {
+	defer close(s.donec)
+
+	t := time.NewTicker(shuttleCheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-s.stopc:
+			return
+		}
+
+		s.mu.Lock()
+		s.check()
+		s.mu.Unlock()
+	}
+}
+
+// check counts the deliveries of the shuttles since the last check. The
+// mutex of s must be held.
+func (s *shuttleSink) check() {
+	var posts, lost uint64
+	for _, p := range s.shuttles {
+		posts += shuttlePosts(p.ls)
+		n, _ := p.ls.Lost.Read()
+		lost += n
+	}
+	s.account(posts, lost)
+}
+
+// account counts the deliveries from the totals of successful posts and lost
+// messages of the shuttles. The mutex of s must be held.
+func (s *shuttleSink) account(posts, lost uint64) {
+	if posts > s.posts {
+		s.delivered()
+	}
+	if lost > s.lost {
+		s.failed(fmt.Errorf("log-shuttle lost %d messages", lost-s.lost))
+	}
+	s.posts, s.lost = posts, lost
+}
+
+// shuttlePosts returns the count of successful posts of ls.
+func shuttlePosts(ls *shuttle.Shuttle) uint64 {
+	if t, ok := ls.MetricsRegistry.Get(shuttlePostSuccess).(interface{ Count() int64 }); ok {
+		return uint64(t.Count())
+	}
+	return 0
+}
+
+func (s *shuttleSink) launch(src shuttleSource) *shuttlePipe {
+	cfg := shuttle.NewConfig()
+	cfg.LogsURL = s.url
+	cfg.Appname = src.appName
+	cfg.Hostname = src.hostname
+	cfg.Procid = src.procID
+	cfg.Prival = strconv.Itoa(src.prival)
+	cfg.ComputeHeader()
+
+	r, w := io.Pipe()
+
+	ls := shuttle.NewShuttle(cfg)
+	ls.LoadReader(r)
+	// failures are reported by the counters, according to the error policy.
+	ls.Logger = log.New(ioutil.Discard, "", 0)
+	ls.ErrLogger = log.New(ioutil.Discard, "", 0)
+	ls.Launch()
+
+	return newShuttlePipe(ls, w)
+}
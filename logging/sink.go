@@ -0,0 +1,111 @@
+package logging
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Message is a log line forwarded to sinks.
+type Message struct {
+	Time time.Time
+
+	// Hostname, AppName and ProcID identify the source of the line, like
+	// the RFC 5424 header fields.
+	Hostname string
+	AppName  string
+	ProcID   string
+
+	// Severity is the syslog severity of the line.
+	Severity Severity
+
+	// Data are the structured data parameters of the line.
+	Data []Param
+
+	// Text is the log line, without the trailing newline.
+	Text string
+}
+
+// Sink delivers log messages to a destination. Write is not called
+// concurrently, and must not block on a remote destination: network sinks
+// buffer messages, and drop them once their buffer is full. Close flushes
+// the buffered messages.
+type Sink interface {
+	Write(m Message) error
+	Close() error
+}
+
+// OpenSink returns the sink of a destination URL, selected by its scheme:
+//
+//	http, https                   Logplex logdrain, through log-shuttle
+//	syslog, syslog+tcp            RFC 5424 syslog over TCP, with octet counting framing
+//	syslog+tls                    RFC 5424 syslog over TLS, with octet counting framing
+//	syslog+udp                    RFC 5424 syslog over UDP
+//	json+http, json+https         batches of JSON messages, posted to the http(s) URL
+//	file                          lines appended to the file at the URL path
+//	stdout, stderr                lines written to the standard output or error
+func OpenSink(rawurl string) (Sink, error) {
+	return openSink(rawurl, nil, nil, false)
+}
+
+// countedSink is a sink maintaining delivery counters.
+type countedSink interface {
+	Sink
+	stats() SinkStats
+}
+
+// openSink opens the sink of rawurl, reporting its delivery failures. Network
+// sinks are spooled in the directory of spool if not nil: Logplex logdrains
+// are then posted to directly, since log-shuttle drops the lines it fails to
+// deliver. They are also posted to directly if multiline is set, since
+// log-shuttle splits multi-line messages into lines.
+func openSink(rawurl string, report func(sink string, err error, failures int), spool *Spool, multiline bool) (countedSink, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	c := newCounters(sinkName(u), report)
+
+	switch u.Scheme {
+	case "http", "https":
+		if spool != nil || multiline {
+			return newHTTPSink(u, c, spool)
+		}
+		return newShuttleSink(rawurl, c), nil
+	case "syslog", "syslog+tcp":
+		return newSyslogSink(u, "tcp", c, spool)
+	case "syslog+tls":
+		return newSyslogSink(u, "tls", c, spool)
+	case "syslog+udp":
+		return newSyslogSink(u, "udp", c, spool)
+	case "json+http", "json+https":
+		return newHTTPSink(u, c, spool)
+	case "file":
+		return openFileSink(u.Path, c)
+	case "stdout", "stderr":
+		return newStdSink(u.Scheme, c), nil
+	case "":
+		return nil, fmt.Errorf("logging: missing scheme in sink URL %q", u.Path)
+	default:
+		return nil, fmt.Errorf("logging: unsupported sink scheme %q", u.Scheme)
+	}
+}
+
+// sinkName returns the name of a sink URL in errors and stats, without
+// credentials nor path of network sinks.
+func sinkName(u *url.URL) string {
+	if u.Scheme == "file" {
+		return u.Scheme + "://" + u.Path
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// nilValue returns s, or the RFC 5424 NILVALUE if s is empty. Spaces, which
+// separate the header fields, are replaced.
+func nilValue(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Replace(s, " ", "_", -1)
+}
@@ -0,0 +1,280 @@
+package logging
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMessages = []Message{
+	{
+		Time:     time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC),
+		Hostname: "app-id",
+		AppName:  "app",
+		ProcID:   "web.1",
+		Text:     "hello",
+	},
+	{
+		Time:     time.Date(2020, 1, 2, 3, 4, 6, 0, time.UTC),
+		Severity: SeverityError,
+		Data:     []Param{{"at", "error"}, {"msg", `"quoted"`}},
+		Text:     `at=error msg="\"quoted\""`,
+	},
+}
+
+var testSyslogMessages = []string{
+	"<190>1 2020-01-02T03:04:05.000006Z app-id app web.1 - - hello",
+	`<187>1 2020-01-02T03:04:06.000000Z - - - - [fields@32473 at="error" msg="\"quoted\""] at=error msg="\"quoted\""`,
+}
+
+func TestOpenSinkErrors(t *testing.T) {
+	tests := []struct {
+		url, err string
+	}{
+		{"ftp://example.com", `logging: unsupported sink scheme "ftp"`},
+		{"example.com", `logging: missing scheme in sink URL "example.com"`},
+		{"syslog+tcp:///path", `logging: missing host in syslog+tcp sink URL`},
+		{"json+https:///path", `logging: missing host in json+https sink URL`},
+	}
+
+	for _, test := range tests {
+		_, err := OpenSink(test.url)
+		if err == nil {
+			t.Errorf("%s: want error", test.url)
+			continue
+		}
+		if want, got := test.err, err.Error(); want != got {
+			t.Errorf("%s: want error %q, got %q", test.url, want, got)
+		}
+	}
+}
+
+func TestSyslogSinkTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	datac := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			datac <- err.Error()
+			return
+		}
+		defer conn.Close()
+
+		data, _ := ioutil.ReadAll(conn)
+		datac <- string(data)
+	}()
+
+	writeSink(t, "syslog+tcp://"+ln.Addr().String(), testMessages)
+
+	var want string
+	for _, msg := range testSyslogMessages {
+		want += string(appendFrame(nil, []byte(msg)))
+	}
+	if got := <-datac; want != got {
+		t.Errorf("want data %q, got %q", want, got)
+	}
+}
+
+func TestSyslogSinkStalled(t *testing.T) {
+	defer func(timeout time.Duration) { syslogWriteTimeout = timeout }(syslogWriteTimeout)
+	syslogWriteTimeout = 100 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// the server accepts the connection, but never reads from it.
+	connc := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			connc <- conn
+		}
+	}()
+
+	s := &syslogSink{network: "tcp", addr: ln.Addr().String()}
+
+	batch := make([]Message, DefaultBatchSize)
+	for i := range batch {
+		batch[i] = Message{Text: strings.Repeat("x", 1024)}
+	}
+
+	// the delivery fails once the socket buffers are full.
+	for i := 0; ; i++ {
+		if i == 100 {
+			t.Fatal("want delivery to time out")
+		}
+
+		n, err := s.deliver(batch)
+		if err == nil {
+			continue
+		}
+		if nerr, ok := err.(net.Error); !ok || !nerr.Timeout() {
+			t.Fatalf("want timeout error, got %v", err)
+		}
+		if n >= len(batch) {
+			t.Errorf("want partial delivery, got %d of %d messages", n, len(batch))
+		}
+		break
+	}
+
+	if s.conn != nil {
+		t.Error("want connection closed after timeout")
+	}
+	(<-connc).Close()
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	writeSink(t, "syslog+udp://"+conn.LocalAddr().String(), testMessages)
+
+	buf := make([]byte, 1024)
+	for _, want := range testSyslogMessages {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); want != got {
+			t.Errorf("want datagram %q, got %q", want, got)
+		}
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var got []jsonMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if want, got := "application/json", r.Header.Get("Content-Type"); want != got {
+			t.Errorf("want content type %q, got %q", want, got)
+		}
+
+		var batch []jsonMessage
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Error(err)
+		}
+		got = append(got, batch...)
+	}))
+	defer srv.Close()
+
+	writeSink(t, "json+"+srv.URL+"/logs", testMessages)
+
+	want := []jsonMessage{
+		{Time: testMessages[0].Time, Hostname: "app-id", AppName: "app", ProcID: "web.1", Severity: "info", Text: "hello"},
+		{
+			Time:     testMessages[1].Time,
+			Severity: "err",
+			Data:     map[string]string{"at": "error", "msg": `"quoted"`},
+			Text:     testMessages[1].Text,
+		},
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want messages %+v, got %+v", want, got)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dyno.log")
+	writeSink(t, "file://"+path, testMessages)
+
+	want := "2020-01-02T03:04:05.000006Z app[web.1]: hello\n" +
+		"2020-01-02T03:04:06.000000Z -[-]: " + testMessages[1].Text + "\n"
+	if got := readFile(t, path); want != got {
+		t.Errorf("want file %q, got %q", want, got)
+	}
+}
+
+func TestForwarder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	paths := []string{filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")}
+
+	f := &Forwarder{
+		LogdrainURLs: []string{"file://" + paths[0], "file://" + paths[1]},
+		AppName:      "app",
+		ProcessID:    "web.1",
+	}
+
+	long := strings.Repeat("x", MaxLineLength+1)
+	f.Forward(ioutil.NopCloser(strings.NewReader("hello\n" + long + "\n")))
+
+	res := make(chan error)
+	go func() { res <- f.Run() }()
+	f.Stop(nil)
+
+	if err := <-res; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		var lines []string
+		for _, line := range strings.Split(strings.TrimSuffix(readFile(t, path), "\n"), "\n") {
+			lines = append(lines, line[strings.Index(line, " ")+1:])
+		}
+
+		want := []string{
+			"app[web.1]: hello",
+			"app[web.1]: " + long[:MaxLineLength],
+			"app[web.1]: x",
+		}
+		if !reflect.DeepEqual(want, lines) {
+			t.Errorf("%s: want lines %q, got %q", path, want, lines)
+		}
+	}
+}
+
+func writeSink(t *testing.T, rawurl string, msgs []Message) {
+	t.Helper()
+
+	sink, err := OpenSink(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range msgs {
+		if err := sink.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
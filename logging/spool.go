@@ -0,0 +1,366 @@
+package logging
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Default spool sizes.
+const (
+	DefaultSpoolMaxSize     = 256 << 20
+	DefaultSpoolSegmentSize = 8 << 20
+)
+
+// Spool configures the disk-backed buffers of the network sinks of a
+// Forwarder. Messages are appended to the segment files of a directory per
+// sink, and delivered in order: failed deliveries are retried until the sink
+// recovers, instead of being dropped. Messages written while the spool is
+// full are dropped.
+//
+// The messages left in the spool when the forwarder stops are delivered by
+// the next forwarder with the same spool directory, AppID and ProcessID.
+// Messages may be delivered twice across restarts. The spool of a sink is
+// locked by its forwarder: concurrent forwarders fail to open it.
+type Spool struct {
+	// Dir is the directory of the spools of the sinks. Each sink has its own
+	// subdirectory, keyed by the full URL of the sink and the identity of
+	// the forwarder.
+	Dir string
+
+	// MaxSize bounds the size in bytes of the segment files of a sink, or
+	// DefaultSpoolMaxSize if zero.
+	MaxSize int64
+
+	// SegmentSize is the size in bytes of a segment file, or
+	// DefaultSpoolSegmentSize if zero.
+	SegmentSize int64
+
+	// Sync determines when the segment files are synced to disk.
+	Sync SyncPolicy
+}
+
+// SyncPolicy determines when spooled messages are synced to disk.
+type SyncPolicy int
+
+// Sync policies.
+const (
+	// SyncSegment syncs segment files once full, and when the spool is
+	// closed.
+	SyncSegment SyncPolicy = iota
+
+	// SyncAlways syncs each spooled message.
+	SyncAlways
+
+	// SyncNever leaves syncing to the operating system.
+	SyncNever
+)
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncSegment:
+		return "segment"
+	case SyncAlways:
+		return "always"
+	case SyncNever:
+		return "never"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseSyncPolicy returns the sync policy named s: segment, always or never.
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	for _, p := range []SyncPolicy{SyncSegment, SyncAlways, SyncNever} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("logging: unknown sync policy %q", s)
+}
+
+// errSpoolFull is returned when a message is written to a full spool.
+var errSpoolFull = errors.New("logging: spool is full")
+
+// spool is the disk-backed FIFO of the messages of a sink. Messages are
+// stored as JSON lines. The last segment is written, the first one is read
+// from roff.
+type spool struct {
+	Spool
+	lock *os.File
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	segments []segment
+	w        *os.File
+	roff     int64
+	size     int64
+	dropped  uint64
+	closed   bool
+}
+
+type segment struct {
+	seq  uint64
+	size int64
+}
+
+// spoolDir returns the spool directory of the sink of rawurl, in dir, for
+// the forwarder of the given app and process. The URL credentials are hashed,
+// rather than stored in the directory name.
+func spoolDir(dir, appID, processID, rawurl string) string {
+	h := sha256.New()
+	for _, s := range []string{appID, processID, rawurl} {
+		io.WriteString(h, s)
+		h.Write([]byte{0})
+	}
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil)[:16]))
+}
+
+// openSpool opens and locks the spool of the directory cfg.Dir.
+func openSpool(cfg Spool) (*spool, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultSpoolMaxSize
+	}
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = DefaultSpoolSegmentSize
+	}
+
+	s := &spool{
+		Spool: cfg,
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	lock, err := os.OpenFile(filepath.Join(s.Dir, "lock"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		lock.Close()
+		if err == syscall.EWOULDBLOCK {
+			return nil, fmt.Errorf("logging: spool %s is in use", s.Dir)
+		}
+		return nil, err
+	}
+	s.lock = lock
+
+	if err := s.load(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// load lists the segments of a previous spool, and starts a new segment.
+func (s *spool) load() error {
+	infos, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range infos {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(fi.Name(), ".seg"), 10, 64)
+		if err != nil || !strings.HasSuffix(fi.Name(), ".seg") {
+			continue
+		}
+		s.segments = append(s.segments, segment{seq: seq, size: fi.Size()})
+		s.size += fi.Size()
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+
+	// the last segment of a previous spool may end with a partial message:
+	// messages are written to a new segment.
+	return s.rotate()
+}
+
+func (s *spool) path(seq uint64) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%020d.seg", seq))
+}
+
+// rotate starts a new segment.
+func (s *spool) rotate() error {
+	var seq uint64
+	if len(s.segments) > 0 {
+		seq = s.segments[len(s.segments)-1].seq + 1
+	}
+
+	if s.w != nil {
+		if err := s.closeSegment(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(s.path(seq), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	s.w = f
+	s.segments = append(s.segments, segment{seq: seq})
+	return nil
+}
+
+func (s *spool) closeSegment() error {
+	if s.Sync != SyncNever {
+		if err := s.w.Sync(); err != nil {
+			s.w.Close()
+			return err
+		}
+	}
+	return s.w.Close()
+}
+
+// write appends m to the spool.
+func (s *spool) write(m Message) error {
+	rec, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	rec = append(rec, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.New("logging: spool is closed")
+	}
+	if s.size+int64(len(rec)) > s.MaxSize {
+		s.dropped += uint64(len(rec))
+		return errSpoolFull
+	}
+
+	if last := s.segments[len(s.segments)-1]; last.size > 0 && last.size+int64(len(rec)) > s.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := s.w.Write(rec)
+	s.segments[len(s.segments)-1].size += int64(n)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if s.Sync == SyncAlways {
+		if err := s.w.Sync(); err != nil {
+			return err
+		}
+	}
+	s.cond.Signal()
+	return nil
+}
+
+// next returns up to max messages from the read position, the position
+// following each of them, and the position following the records read in the
+// first segment, to be acknowledged once delivered. Undecodable messages,
+// partially written by a previous spool, are skipped.
+// Next blocks until messages are spooled, or returns io.EOF once the spool
+// is closed and empty.
+func (s *spool) next(max int) ([]Message, []int64, int64, error) {
+	s.mu.Lock()
+	for !s.unread() && !s.closed {
+		s.cond.Wait()
+	}
+	if !s.unread() {
+		s.mu.Unlock()
+		return nil, nil, 0, io.EOF
+	}
+	seg, off := s.segments[0], s.roff
+	s.mu.Unlock()
+
+	f, err := os.Open(s.path(seg.seq))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer f.Close()
+
+	var (
+		batch []Message
+		ends  []int64
+	)
+	br := bufio.NewReader(io.NewSectionReader(f, off, seg.size-off))
+	for len(batch) < max {
+		rec, err := br.ReadBytes('\n')
+		off += int64(len(rec))
+
+		var m Message
+		if len(rec) > 0 && rec[len(rec)-1] == '\n' && json.Unmarshal(rec, &m) == nil {
+			batch = append(batch, m)
+			ends = append(ends, off)
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	return batch, ends, off, nil
+}
+
+// unread removes the read segments, and reports whether messages are left to
+// read.
+func (s *spool) unread() bool {
+	for len(s.segments) > 1 && s.roff >= s.segments[0].size {
+		if err := os.Remove(s.path(s.segments[0].seq)); err != nil && !os.IsNotExist(err) {
+			break
+		}
+		s.size -= s.segments[0].size
+		s.segments = s.segments[1:]
+		s.roff = 0
+	}
+	return s.roff < s.segments[0].size
+}
+
+// ack moves the read position to off, once the messages returned by next are
+// delivered.
+func (s *spool) ack(off int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roff = off
+	s.unread()
+}
+
+// stats returns the size of the unread messages, and of the messages dropped
+// when full.
+func (s *spool) stats() (spooled, dropped uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return uint64(s.size - s.roff), s.dropped
+}
+
+// stop wakes up next once the spool is empty.
+func (s *spool) stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	s.cond.Broadcast()
+}
+
+// close closes the written segment, and unlocks the spool. The spool must be
+// stopped.
+func (s *spool) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.lock.Close()
+	return s.closeSegment()
+}
@@ -0,0 +1,406 @@
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := Spool{Dir: dir, SegmentSize: 1}
+
+	s, err := openSpool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range testMessages {
+		if err := s.write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// one segment per message.
+	batch, _, off, err := s.next(DefaultBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testMessages[:1]; !reflect.DeepEqual(want, batch) {
+		t.Errorf("want batch %+v, got %+v", want, batch)
+	}
+	s.ack(off)
+
+	spooled, _ := s.stats()
+	s.stop()
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the unread messages are read by the next spool.
+	s, err = openSpool(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.stats(); spooled != got {
+		t.Errorf("want %d spooled bytes, got %d", spooled, got)
+	}
+
+	batch, _, off, err = s.next(DefaultBatchSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := testMessages[1:]; !reflect.DeepEqual(want, batch) {
+		t.Errorf("want batch %+v, got %+v", want, batch)
+	}
+	s.ack(off)
+
+	s.stop()
+	if _, _, _, err := s.next(DefaultBatchSize); err != io.EOF {
+		t.Errorf("want EOF, got %v", err)
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := filepath.Glob(filepath.Join(s.Dir, "*.seg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 {
+		t.Errorf("want the written segment, got segments %q", segments)
+	}
+}
+
+func TestSpoolFull(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rec, err := json.Marshal(testMessages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	max := int64(len(rec) + 1)
+
+	s, err := openSpool(Spool{Dir: dir, MaxSize: max})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+
+	if err := s.write(testMessages[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.write(testMessages[1]); err != errSpoolFull {
+		t.Fatalf("want error %v, got %v", errSpoolFull, err)
+	}
+
+	spooled, dropped := s.stats()
+	if uint64(max) != spooled {
+		t.Errorf("want %d spooled bytes, got %d", max, spooled)
+	}
+	if dropped == 0 {
+		t.Errorf("want dropped bytes")
+	}
+}
+
+func TestSpoolLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := openSpool(Spool{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openSpool(Spool{Dir: dir}); err == nil {
+		t.Fatal("want error for a spool in use")
+	}
+
+	s.stop()
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = openSpool(Spool{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.stop()
+	s.close()
+}
+
+func TestForwarderSpoolDrains(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		mu  sync.Mutex
+		got = make(map[string][]byte)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		body, _ := ioutil.ReadAll(r.Body)
+
+		mu.Lock()
+		defer mu.Unlock()
+		got[user] = append(got[user], body...)
+	}))
+	defer srv.Close()
+
+	// the drains of two apps on the same host, with the same spool directory.
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var forwarders []*Forwarder
+	for _, token := range []string{"token-a", "token-b"} {
+		u.User = url.UserPassword(token, "")
+		forwarders = append(forwarders, &Forwarder{
+			LogdrainURLs: []string{u.String() + "/logs"},
+			AppName:      "app",
+			AppID:        token,
+			ProcessID:    "web.1",
+			Spool:        &Spool{Dir: dir},
+		})
+	}
+
+	var wg sync.WaitGroup
+	for _, f := range forwarders {
+		f.Forward(ioutil.NopCloser(strings.NewReader("line of " + f.AppID + "\n")))
+
+		wg.Add(1)
+		go func(f *Forwarder) {
+			defer wg.Done()
+			if err := f.Run(); err != nil {
+				t.Error(err)
+			}
+		}(f)
+	}
+	for _, f := range forwarders {
+		f.Stop(nil)
+	}
+	wg.Wait()
+
+	for _, token := range []string{"token-a", "token-b"} {
+		body := string(got[token])
+		if want := "line of " + token; strings.Count(body, "line of ") != 1 || !strings.Contains(body, want) {
+			t.Errorf("%s: want a single %q line, got %q", token, want, body)
+		}
+	}
+
+	spools, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 2, len(spools); want != got {
+		t.Errorf("want %d spools, got %d", want, got)
+	}
+}
+
+func TestSpoolReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		requests int
+		got      []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the logdrain recovers after the first delivery.
+		if requests++; requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		if want, got := "application/logplex-1", r.Header.Get("Content-Type"); want != got {
+			t.Errorf("want content type %q, got %q", want, got)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		got = append(got, body...)
+	}))
+	defer srv.Close()
+
+	sink, err := openSink(srv.URL+"/logs", nil, &Spool{Dir: dir}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range testMessages {
+		if err := sink.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// wait for the retry before closing the sink.
+	for sink.stats().Spooled > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var want []byte
+	for _, msg := range testSyslogMessages {
+		want = appendFrame(want, []byte(msg))
+	}
+	if string(want) != string(got) {
+		t.Errorf("want body %q, got %q", want, got)
+	}
+
+	if stats := sink.stats(); stats.Errors != 1 || stats.Dropped != 0 {
+		t.Errorf("want 1 error and no drops, got stats %+v", stats)
+	}
+}
+
+func TestSpoolReplayPartial(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// spool the messages before replaying them in a single batch.
+	s, err := openSpool(Spool{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range testMessages {
+		if err := s.write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.stop()
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var batches [][]Message
+	deliver := func(batch []Message) (int, error) {
+		batches = append(batches, append([]Message(nil), batch...))
+
+		// only the first message of the first batch is delivered.
+		if len(batches) == 1 {
+			return 1, errors.New("connection reset")
+		}
+		return len(batch), nil
+	}
+
+	q, err := newQueue(newCounters("test", nil), &Spool{Dir: dir}, deliver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for q.stats().Spooled > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]Message{testMessages, testMessages[1:]}
+	if !reflect.DeepEqual(want, batches) {
+		t.Errorf("want batches %+v, got %+v", want, batches)
+	}
+}
+
+func TestSpoolReplayRejected(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		mu       sync.Mutex
+		requests int
+		got      []byte
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// the logdrain rejects the first batch.
+		if requests++; requests == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		got = append(got, body...)
+	}))
+	defer srv.Close()
+
+	sink, err := openSink(srv.URL+"/logs", nil, &Spool{Dir: dir}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the second message is written once the first batch is rejected.
+	if err := sink.Write(testMessages[0]); err != nil {
+		t.Fatal(err)
+	}
+	for sink.stats().Errors == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := sink.Write(testMessages[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	for sink.stats().Spooled > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if d := time.Since(start); d >= spoolMinRetryDelay {
+		t.Errorf("want rejected batch not to be retried, waited %s", d)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := string(appendFrame(nil, []byte(testSyslogMessages[1]))); want != string(got) {
+		t.Errorf("want body %q, got %q", want, got)
+	}
+	if stats := sink.stats(); stats.Errors != 1 || stats.Dropped != 1 {
+		t.Errorf("want 1 error and 1 drop, got stats %+v", stats)
+	}
+}
+
+func TestParseSyncPolicy(t *testing.T) {
+	for _, p := range []SyncPolicy{SyncSegment, SyncAlways, SyncNever} {
+		got, err := ParseSyncPolicy(p.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != got {
+			t.Errorf("want policy %v, got %v", p, got)
+		}
+	}
+
+	if _, err := ParseSyncPolicy("sometimes"); err == nil {
+		t.Error("want error")
+	}
+}
@@ -0,0 +1,156 @@
+package logging
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SinkStats are the delivery counters of a sink.
+type SinkStats struct {
+	// Sink is the URL of the sink, without credentials nor path.
+	Sink string
+
+	// Dropped counts the messages dropped by the sink, when its buffer is
+	// full or when their delivery has failed.
+	Dropped uint64
+
+	// Errors counts the failed deliveries.
+	Errors uint64
+
+	// Spooled is the size in bytes of the messages waiting in the spool of
+	// the sink, and SpoolDropped the size of the messages dropped while the
+	// spool was full.
+	Spooled      uint64
+	SpoolDropped uint64
+}
+
+// StreamStats are the counters of the lines of a stream, before their
+// delivery to the sinks.
+type StreamStats struct {
+	ProcID string
+
+	// Redactions counts the secrets redacted from the lines.
+	Redactions uint64
+
+	// RateLimited counts the lines dropped by the rate limit, and Sampled
+	// the debug lines dropped by sampling.
+	RateLimited uint64
+	Sampled     uint64
+}
+
+// ErrorPolicy determines how a Forwarder handles the delivery errors of its
+// sinks.
+type ErrorPolicy int
+
+// Error policies.
+const (
+	// WarnErrors logs delivery errors.
+	WarnErrors ErrorPolicy = iota
+
+	// IgnoreErrors only counts delivery errors.
+	IgnoreErrors
+
+	// FailOnErrors logs delivery errors, and fails the forwarder once a sink
+	// has failed FailureThreshold consecutive deliveries.
+	FailOnErrors
+)
+
+func (p ErrorPolicy) String() string {
+	switch p {
+	case WarnErrors:
+		return "warn"
+	case IgnoreErrors:
+		return "ignore"
+	case FailOnErrors:
+		return "fail"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseErrorPolicy returns the error policy named s: warn, ignore or fail.
+func ParseErrorPolicy(s string) (ErrorPolicy, error) {
+	for _, p := range []ErrorPolicy{WarnErrors, IgnoreErrors, FailOnErrors} {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("logging: unknown error policy %q", s)
+}
+
+// DefaultFailureThreshold is the default number of consecutive delivery
+// failures of the FailOnErrors policy.
+const DefaultFailureThreshold = 5
+
+// DeliveryError is returned by a Forwarder with the FailOnErrors policy once a
+// sink has failed consecutive deliveries.
+type DeliveryError struct {
+	Sink     string
+	Failures int
+
+	// Err is the error of the last delivery.
+	Err error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("logging: %s: %d consecutive delivery failures: %v", e.Sink, e.Failures, e.Err)
+}
+
+// Unwrap returns the error of the last delivery.
+func (e *DeliveryError) Unwrap() error { return e.Err }
+
+// counters are the delivery counters of a sink. Failures are reported to the
+// error policy of the forwarder of the sink.
+type counters struct {
+	name   string
+	report func(sink string, err error, failures int)
+
+	mu          sync.Mutex
+	dropped     uint64
+	errors      uint64
+	consecutive int
+}
+
+func newCounters(name string, report func(sink string, err error, failures int)) *counters {
+	return &counters{
+		name:   name,
+		report: report,
+	}
+}
+
+func (c *counters) drop(n uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.dropped += n
+}
+
+func (c *counters) delivered() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.consecutive = 0
+}
+
+func (c *counters) failed(err error) {
+	c.mu.Lock()
+	c.errors++
+	c.consecutive++
+	failures := c.consecutive
+	c.mu.Unlock()
+
+	if c.report != nil {
+		c.report(c.name, err, failures)
+	}
+}
+
+func (c *counters) stats() SinkStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return SinkStats{
+		Sink:    c.name,
+		Dropped: c.dropped,
+		Errors:  c.errors,
+	}
+}
@@ -0,0 +1,184 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForwarderFailOnErrors(t *testing.T) {
+	postc := make(chan struct{}, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		postc <- struct{}{}
+	}))
+	defer srv.Close()
+
+	f := &Forwarder{
+		LogdrainURLs:     []string{"json+" + srv.URL},
+		ErrorPolicy:      FailOnErrors,
+		FailureThreshold: 2,
+	}
+
+	r, w := io.Pipe()
+	defer w.Close()
+	f.Forward(r)
+
+	res := make(chan error)
+	go func() { res <- f.Run() }()
+
+	for i := 0; i < 2; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+		<-postc
+	}
+
+	select {
+	case err := <-res:
+		var derr *DeliveryError
+		if !errors.As(err, &derr) {
+			t.Fatalf("want *DeliveryError, got %v", err)
+		}
+		if want, got := 2, derr.Failures; want != got {
+			t.Errorf("want %d failures, got %d", want, got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	want := []SinkStats{{Sink: "json+" + srv.URL, Dropped: 2, Errors: 2}}
+	if got := f.Stats(); len(got) != 1 || want[0] != got[0] {
+		t.Errorf("want stats %+v, got %+v", want, got)
+	}
+
+	// lines are discarded once the forwarder has failed.
+	fmt.Fprintln(w, "discarded")
+}
+
+func TestForwarderFailOnErrorsSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var posts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&posts, 1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	f := &Forwarder{
+		LogdrainURLs:     []string{srv.URL},
+		ErrorPolicy:      FailOnErrors,
+		FailureThreshold: 1,
+		Spool:            &Spool{Dir: dir},
+	}
+
+	r, w := io.Pipe()
+	defer w.Close()
+	f.Forward(r)
+
+	res := make(chan error)
+	go func() { res <- f.Run() }()
+
+	fmt.Fprintln(w, "line")
+
+	select {
+	case err := <-res:
+		var derr *DeliveryError
+		if !errors.As(err, &derr) {
+			t.Fatalf("want *DeliveryError, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+
+	// the sinks are closed: the spooled line is not retried anymore.
+	n := atomic.LoadInt32(&posts)
+	time.Sleep(spoolMinRetryDelay + 100*time.Millisecond)
+	if got := atomic.LoadInt32(&posts); n != got {
+		t.Errorf("want %d posts, got %d", n, got)
+	}
+}
+
+func TestShuttleAccount(t *testing.T) {
+	var failures []int
+	c := newCounters("https://logs.example.com", func(sink string, err error, n int) {
+		failures = append(failures, n)
+	})
+	s := &shuttleSink{counters: c}
+
+	// totals of successful posts and lost messages at each check.
+	s.account(0, 10)
+	s.account(0, 20)
+	s.account(1, 20)
+	s.account(1, 30)
+	s.account(1, 30)
+
+	if want, got := []int{1, 2, 1}, failures; fmt.Sprint(want) != fmt.Sprint(got) {
+		t.Errorf("want consecutive failures %v, got %v", want, got)
+	}
+	if want, got := uint64(3), c.stats().Errors; want != got {
+		t.Errorf("want %d errors, got %d", want, got)
+	}
+}
+
+func TestShuttleSinkFull(t *testing.T) {
+	c := newCounters("https://logs.example.com", nil)
+	s := &shuttleSink{counters: c, shuttles: make(map[shuttleSource]*shuttlePipe)}
+
+	// the shuttle stalls, and does not read the pipe.
+	m := Message{AppName: "app", ProcID: "web.1", Text: "hello"}
+	r, w := io.Pipe()
+	p := newShuttlePipe(nil, w)
+	s.shuttles[shuttleSource{appName: m.AppName, procID: m.ProcID, prival: prival(m.Severity)}] = p
+
+	const n = DefaultQueueSize + 2
+	for i := 0; i < n; i++ {
+		if err := s.Write(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dropped := c.stats().Dropped
+	if dropped == 0 {
+		t.Error("want lines dropped once the queue is full")
+	}
+
+	// the queued lines are written once the shuttle resumes.
+	linesc := make(chan int)
+	go func() {
+		data, _ := ioutil.ReadAll(r)
+		linesc <- strings.Count(string(data), "\n")
+	}()
+	p.close()
+
+	if want, got := n-int(dropped), <-linesc; want != got {
+		t.Errorf("want %d lines, got %d", want, got)
+	}
+}
+
+func TestParseErrorPolicy(t *testing.T) {
+	for _, p := range []ErrorPolicy{WarnErrors, IgnoreErrors, FailOnErrors} {
+		got, err := ParseErrorPolicy(p.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != got {
+			t.Errorf("want policy %s, got %s", p, got)
+		}
+	}
+
+	if _, err := ParseErrorPolicy("retry"); err == nil {
+		t.Error("want error")
+	}
+}
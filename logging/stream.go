@@ -0,0 +1,186 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Stream is the metadata of a forwarded reader.
+type Stream struct {
+	// ProcID identifies the stream, e.g. web.1/stderr. It defaults to the
+	// ProcessID of the forwarder.
+	ProcID string
+
+	// Severity is the severity of the lines of the stream.
+	Severity Severity
+
+	// Structured detects JSON objects and logfmt lines, whose fields are
+	// forwarded as structured data.
+	Structured bool
+
+	// Multiline, if not nil, joins the continuation lines of the stream.
+	Multiline *Multiline
+}
+
+// Severity is the syslog severity of a message. The zero value is
+// SeverityInfo.
+type Severity int
+
+// Syslog severities.
+const (
+	SeverityEmergency Severity = iota + 1
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInfo
+	SeverityDebug
+)
+
+var severityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// Code returns the RFC 5424 severity code of s.
+func (s Severity) Code() int {
+	if s <= 0 || s > SeverityDebug {
+		return int(SeverityInfo) - 1
+	}
+	return int(s) - 1
+}
+
+func (s Severity) String() string { return severityNames[s.Code()] }
+
+// StructuredDataID is the SD-ID of the structured data element of messages.
+// It defaults to the enterprise number reserved for documentation.
+var StructuredDataID = "fields@32473"
+
+// Param is a structured data parameter of a message.
+type Param struct {
+	Name, Value string
+}
+
+// maxParamName is the length of the longest RFC 5424 PARAM-NAME.
+const maxParamName = 32
+
+// parseStructured returns the fields of a JSON object or logfmt line, or nil
+// if text is neither. The fields of JSON objects are sorted by name.
+func parseStructured(text string) []Param {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "{") {
+		return parseJSON(text)
+	}
+	return parseLogfmt(text)
+}
+
+func parseJSON(text string) []Param {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(text), &fields); err != nil {
+		return nil
+	}
+
+	params := make([]Param, 0, len(fields))
+	for name, raw := range fields {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+		params = append(params, Param{Name: name, Value: value})
+	}
+
+	sort.Slice(params, func(i, j int) bool { return params[i].Name < params[j].Name })
+	return sanitizeParams(params)
+}
+
+// parseLogfmt parses a line of key=value pairs, whose values may be quoted.
+// Lines with any other token are not logfmt.
+func parseLogfmt(text string) []Param {
+	var params []Param
+	for text != "" {
+		i := strings.IndexAny(text, "= ")
+		if i <= 0 || text[i] != '=' {
+			return nil
+		}
+		name := text[:i]
+		text = text[i+1:]
+
+		var value string
+		if strings.HasPrefix(text, `"`) {
+			end := 1
+			for end < len(text) && text[end] != '"' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				return nil
+			}
+
+			var err error
+			if value, err = strconv.Unquote(text[:end+1]); err != nil {
+				return nil
+			}
+			text = text[end+1:]
+		} else {
+			end := strings.IndexByte(text, ' ')
+			if end < 0 {
+				end = len(text)
+			}
+			value = text[:end]
+			text = text[end:]
+		}
+
+		if text != "" && text[0] != ' ' {
+			return nil
+		}
+		text = strings.TrimLeft(text, " ")
+
+		params = append(params, Param{Name: name, Value: value})
+	}
+	return sanitizeParams(params)
+}
+
+// sanitizeParams returns params with valid RFC 5424 names, dropping the
+// params without any valid character.
+func sanitizeParams(params []Param) []Param {
+	sanitized := params[:0]
+	for _, p := range params {
+		name := strings.Map(func(r rune) rune {
+			if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+				return -1
+			}
+			return r
+		}, p.Name)
+		if len(name) > maxParamName {
+			name = name[:maxParamName]
+		}
+
+		if name != "" {
+			sanitized = append(sanitized, Param{Name: name, Value: p.Value})
+		}
+	}
+	if len(sanitized) == 0 {
+		return nil
+	}
+	return sanitized
+}
+
+// formatStructuredData returns the RFC 5424 STRUCTURED-DATA of params.
+func formatStructuredData(params []Param) string {
+	if len(params) == 0 {
+		return "-"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s", StructuredDataID)
+	for _, p := range params {
+		fmt.Fprintf(&b, ` %s="%s"`, p.Name, sdEscaper.Replace(p.Value))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+var sdEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
@@ -0,0 +1,164 @@
+package logging
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStructured(t *testing.T) {
+	tests := []struct {
+		text string
+		want []Param
+	}{
+		{"hello world", nil},
+		{"at=info", []Param{{"at", "info"}}},
+		{`at=info msg="hello world" n=2`, []Param{{"at", "info"}, {"msg", "hello world"}, {"n", "2"}}},
+		{`at=info msg="unterminated`, nil},
+		{"at=info hello", nil},
+		{"=info", nil},
+		{`{"msg":"hello","at":"info","n":2,"ok":true}`, []Param{{"at", "info"}, {"msg", "hello"}, {"n", "2"}, {"ok", "true"}}},
+		{`{"msg":"hello"`, nil},
+		{`{"a b]":"c"}`, []Param{{"ab", "c"}}},
+		{`{}`, nil},
+	}
+
+	for _, test := range tests {
+		if got := parseStructured(test.text); !reflect.DeepEqual(test.want, got) {
+			t.Errorf("%s: want params %q, got %q", test.text, test.want, got)
+		}
+	}
+}
+
+func TestFormatStructuredData(t *testing.T) {
+	tests := []struct {
+		params []Param
+		want   string
+	}{
+		{nil, "-"},
+		{[]Param{{"at", "info"}}, `[fields@32473 at="info"]`},
+		{[]Param{{"a", `"b\c]`}, {"d", ""}}, `[fields@32473 a="\"b\\c\]" d=""]`},
+	}
+
+	for _, test := range tests {
+		if got := formatStructuredData(test.params); test.want != got {
+			t.Errorf("%q: want %s, got %s", test.params, test.want, got)
+		}
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	tests := []struct {
+		severity Severity
+		code     int
+		name     string
+	}{
+		{0, 6, "info"},
+		{SeverityEmergency, 0, "emerg"},
+		{SeverityError, 3, "err"},
+		{SeverityDebug, 7, "debug"},
+		{SeverityDebug + 1, 6, "info"},
+	}
+
+	for _, test := range tests {
+		if got := test.severity.Code(); test.code != got {
+			t.Errorf("%d: want code %d, got %d", test.severity, test.code, got)
+		}
+		if got := test.severity.String(); test.name != got {
+			t.Errorf("%d: want name %q, got %q", test.severity, test.name, got)
+		}
+	}
+}
+
+func TestForwardStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dyno.log")
+
+	f := &Forwarder{
+		LogdrainURLs: []string{"file://" + path},
+		AppName:      "app",
+		ProcessID:    "web.1",
+	}
+	f.Forward(ioutil.NopCloser(strings.NewReader("hello\n")))
+	f.ForwardStream(ioutil.NopCloser(strings.NewReader("world\n")), Stream{
+		ProcID:   "web.1/stderr",
+		Severity: SeverityError,
+	})
+
+	res := make(chan error)
+	go func() { res <- f.Run() }()
+	f.Stop(nil)
+
+	if err := <-res; err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSuffix(readFile(t, path), "\n"), "\n") {
+		lines = append(lines, line[strings.Index(line, " ")+1:])
+	}
+
+	if want := "app[web.1]: hello"; !contains(lines, want) {
+		t.Errorf("want line %q, got %q", want, lines)
+	}
+	if want := "app[web.1/stderr]: world"; !contains(lines, want) {
+		t.Errorf("want line %q, got %q", want, lines)
+	}
+}
+
+func contains(lines []string, line string) bool {
+	for _, l := range lines {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+func TestForwardSystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "dyno.log")
+
+	f := &Forwarder{
+		LogdrainURLs: []string{"file://" + path},
+		AppName:      "app",
+		ProcessID:    "web.1",
+		RateLimit:    &RateLimit{LinesPerSecond: 0.001, LineBurst: 1},
+	}
+	w := f.ForwardSystem()
+
+	res := make(chan error)
+	go func() { res <- f.Run() }()
+
+	io.WriteString(w, "Starting process with pid 42\nProcess exited with status 0\n")
+	w.Close()
+	f.Stop(nil)
+
+	if err := <-res; err != nil {
+		t.Fatal(err)
+	}
+
+	want := "app[dynolab]: Starting process with pid 42\n" +
+		"app[dynolab]: Process exited with status 0\n"
+	var got string
+	for _, line := range strings.SplitAfter(readFile(t, path), "\n") {
+		got += line[strings.Index(line, " ")+1:]
+	}
+	if want != got {
+		t.Errorf("want lines %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,147 @@
+package logging
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// syslogFacility is the facility of forwarded lines: local7, like Logplex.
+const syslogFacility = 23
+
+// syslogDialTimeout bounds the connection to a syslog server.
+const syslogDialTimeout = 10 * time.Second
+
+// syslogWriteTimeout bounds the delivery of a batch, so that a stalled syslog
+// server does not block the sink.
+var syslogWriteTimeout = 10 * time.Second
+
+// syslogSink delivers RFC 5424 messages to a syslog server. Stream
+// connections are established on the first delivery, and again after an
+// error.
+type syslogSink struct {
+	*queue
+
+	network, addr string
+	tlsConfig     *tls.Config
+
+	conn net.Conn
+}
+
+func newSyslogSink(u *url.URL, network string, c *counters, spool *Spool) (*syslogSink, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("logging: missing host in %s sink URL", u.Scheme)
+	}
+
+	s := &syslogSink{
+		network: network,
+		addr:    u.Host,
+	}
+	if network == "tls" {
+		s.tlsConfig = &tls.Config{ServerName: u.Hostname()}
+	}
+	q, err := newQueue(c, spool, s.deliver)
+	if err != nil {
+		return nil, err
+	}
+	s.queue = q
+	return s, nil
+}
+
+// Close delivers the queued messages, and closes the connection.
+func (s *syslogSink) Close() error {
+	s.queue.Close()
+
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return nil
+}
+
+func (s *syslogSink) deliver(batch []Message) (int, error) {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return 0, err
+		}
+		s.conn = conn
+	}
+
+	n, err := s.write(batch)
+	if err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return n, err
+}
+
+// write writes the batch to the connection within the syslogWriteTimeout,
+// and returns the number of messages written. Messages partially written to a
+// stream connection are not counted.
+func (s *syslogSink) write(batch []Message) (int, error) {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout)); err != nil {
+		return 0, err
+	}
+
+	if s.network == "udp" {
+		for i, m := range batch {
+			if _, err := s.conn.Write(formatSyslog(nil, m)); err != nil {
+				return i, err
+			}
+		}
+		return len(batch), nil
+	}
+
+	var buf []byte
+	ends := make([]int, 0, len(batch))
+	for _, m := range batch {
+		buf = appendFrame(buf, formatSyslog(nil, m))
+		ends = append(ends, len(buf))
+	}
+
+	written, err := s.conn.Write(buf)
+	n := 0
+	for n < len(ends) && ends[n] <= written {
+		n++
+	}
+	return n, err
+}
+
+func (s *syslogSink) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	if s.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, "tcp", s.addr, s.tlsConfig)
+	}
+	return dialer.Dial(s.network, s.addr)
+}
+
+// formatSyslog appends the RFC 5424 representation of m to buf.
+func formatSyslog(buf []byte, m Message) []byte {
+	w := bytes.NewBuffer(buf)
+	fmt.Fprintf(w, "<%d>1 %s %s %s %s - %s %s",
+		prival(m.Severity),
+		m.Time.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		nilValue(m.Hostname),
+		nilValue(m.AppName),
+		nilValue(m.ProcID),
+		formatStructuredData(m.Data),
+		m.Text,
+	)
+	return w.Bytes()
+}
+
+// prival returns the RFC 5424 PRI of a line of severity s.
+func prival(s Severity) int {
+	return syslogFacility*8 + s.Code()
+}
+
+// appendFrame appends msg to buf with RFC 6587 octet counting framing.
+func appendFrame(buf, msg []byte) []byte {
+	buf = strconv.AppendInt(buf, int64(len(msg)), 10)
+	buf = append(buf, ' ')
+	return append(buf, msg...)
+}
@@ -1,21 +1,14 @@
-// +build linux
-
 package main
 
 import (
+	"bytes"
 	"flag"
-	"fmt"
-	"io"
+	"go/format"
 	"io/ioutil"
 	"log"
 	"os"
 	"strings"
-	"syscall"
 	"text/template"
-	"unsafe"
-
-	libseccomp "github.com/seccomp/libseccomp-golang"
-	"golang.org/x/sys/unix"
 
 	"github.com/heroku/dynolab/seccomp"
 )
@@ -24,6 +17,8 @@ var (
 	out     = flag.String("o", "", "output file")
 	pkg     = flag.String("pkg", "seccomp", "package name")
 	varName = flag.String("var", "prog", "variable name")
+	arches  = flag.String("arch", "", "comma separated list of architectures")
+	verify  = flag.Bool("verify", false, "verify the output file is up to date instead of writing it")
 )
 
 func main() {
@@ -32,98 +27,89 @@ func main() {
 		log.Fatal("missing -o argument")
 	}
 
-	filter, err := libseccomp.NewFilter(libseccomp.ActAllow)
-	if err != nil {
-		log.Fatal(err)
+	if *arches == "" {
+		log.Fatal("missing -arch argument")
 	}
 
-	for _, syscall := range seccomp.BlockedSyscalls {
-		if err := filter.AddRule(libseccomp.ScmpSyscall(syscall), libseccomp.ActErrno.SetReturnCode(int16(unix.EPERM))); err != nil {
+	profile := *seccomp.DefaultProfile
+	for _, name := range strings.Split(*arches, ",") {
+		var arch seccomp.Arch
+		if err := arch.UnmarshalText([]byte(name)); err != nil {
 			log.Fatal(err)
 		}
+		profile.Architectures = append(profile.Architectures, arch)
 	}
 
-	tmpPFC, err := ioutil.TempFile("", "prog.pfc")
+	prog, err := seccomp.Compile(&profile)
 	if err != nil {
 		log.Fatal(err)
 	}
-	if err := filter.ExportPFC(tmpPFC); err != nil {
-		log.Fatal(err)
-	}
-	if _, err := tmpPFC.Seek(0, 0); err != nil {
-		log.Fatal(err)
-	}
 
-	tmpBPF, err := ioutil.TempFile("", "prog.bpf")
-	if err != nil {
-		log.Fatal(err)
+	noun := "architecture"
+	if len(profile.Architectures) > 1 {
+		noun = "architectures"
 	}
-	if err := filter.ExportBPF(tmpBPF); err != nil {
-		log.Fatal(err)
-	}
-	if _, err := tmpBPF.Seek(0, 0); err != nil {
-		log.Fatal(err)
+
+	data := struct {
+		Package     string
+		Arches      string
+		ArchNoun    string
+		Disassembly string
+		Program     seccomp.Program
+		VarName     string
+	}{
+		Package:     *pkg,
+		Arches:      strings.Replace(*arches, ",", ", ", -1),
+		ArchNoun:    noun,
+		Disassembly: strings.Replace(strings.TrimSuffix(prog.String(), "\n"), "\n", "\n\t", -1),
+		Program:     prog,
+		VarName:     *varName,
 	}
 
-	pfc, err := ioutil.ReadAll(tmpPFC)
-	if err != nil {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
 		log.Fatal(err)
 	}
-	pfc = pfc[:len(pfc)-1]
 
-	bpf, err := ioutil.ReadAll(tmpBPF)
+	src, err := format.Source(buf.Bytes())
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	lenBPF := len(bpf)
-	encodedBPF := fmt.Sprintf("%#v\n", bpf)
-	progLen := lenBPF / int(unsafe.Sizeof(syscall.SockFilter{}))
-
-	data := struct {
-		Package         string
-		ProgLen         int
-		PFC, EncodedBPF string
-		VarName         string
-	}{
-		Package:    *pkg,
-		ProgLen:    progLen,
-		PFC:        strings.Replace(string(pfc), "\n", "\n\t", -1),
-		EncodedBPF: encodedBPF,
-		VarName:    *varName,
-	}
-
-	var w io.Writer = os.Stdout
-	if *out != "" {
-		if w, err = os.Create(*out); err != nil {
+	if *verify {
+		existing, err := ioutil.ReadFile(*out)
+		if err != nil {
 			log.Fatal(err)
 		}
+		if !bytes.Equal(existing, src) {
+			log.Printf("%s is out of date, regenerate with go generate", *out)
+			os.Exit(1)
+		}
+		return
 	}
 
-	if err := tmpl.Execute(w, data); err != nil {
+	if err := ioutil.WriteFile(*out, src, 0644); err != nil {
 		log.Fatal(err)
 	}
 }
 
-var tmpl = template.Must(template.New("output.go").Parse(`// Code generated by github.com/heroku/dynolab/seccomp/generate. DO NOT EDIT.
+var tmpl = template.Must(template.New("output.go").Parse(`// Code generated by github.com/heroku/dynolab/seccomp/_generate. DO NOT EDIT.
 
 package {{ .Package }}
 
-import (
-	"syscall"
-	"unsafe"
-)
-
 func init() {
-	{{ .VarName }} = &syscall.SockFprog{
-		Len:    {{ .ProgLen }},
-		Filter: (*syscall.SockFilter)(unsafe.Pointer(&{{ .VarName }}Data[0])),
-	}
+	{{ .VarName }} = {{ .VarName }}Data.SockFprog()
 }
 
 /*
-	{{ .PFC }}
+	{{ .Disassembly }}
 */
 
-// {{ .VarName }}Data is the BFP program data.
-var {{ .VarName }}Data = {{ .EncodedBPF }}`))
+// {{ .VarName }}Data is the BPF program of DefaultProfile for the
+// {{ .Arches }} {{ .ArchNoun }}.
+var {{ .VarName }}Data = Program{
+{{- range .Program }}
+	{Code: {{ printf "%#x" .Code }}, Jt: {{ .Jt }}, Jf: {{ .Jf }}, K: {{ printf "%#x" .K }}},
+{{- end }}
+}
+`))
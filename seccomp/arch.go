@@ -0,0 +1,104 @@
+package seccomp
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Arch is an audit architecture, as reported in the arch field of struct
+// seccomp_data. See include/uapi/linux/audit.h in Linux.
+type Arch uint32
+
+// Supported audit architectures.
+const (
+	ArchX86_64  Arch = 0xc000003e
+	ArchI386    Arch = 0x40000003
+	ArchAARCH64 Arch = 0xc00000b7
+)
+
+type archInfo struct {
+	name     string
+	syscalls map[string]int32
+
+	// is32bit architectures only compare the low word of syscall arguments.
+	is32bit bool
+
+	// syscallMask is the range of syscall numbers of other ABIs sharing the
+	// architecture (e.g. x32 on x86_64) which are treated as a bad arch.
+	syscallMask uint32
+}
+
+var archTable = map[Arch]archInfo{
+	ArchX86_64: {
+		name:        "x86_64",
+		syscalls:    syscallsX86_64,
+		syscallMask: x32SyscallBit,
+	},
+	ArchI386: {
+		name:     "i386",
+		syscalls: syscallsI386,
+		is32bit:  true,
+	},
+	ArchAARCH64: {
+		name:     "aarch64",
+		syscalls: syscallsAARCH64,
+	},
+}
+
+func (a Arch) String() string {
+	if info, ok := archTable[a]; ok {
+		return info.name
+	}
+	return fmt.Sprintf("arch(%#x)", uint32(a))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (a Arch) MarshalText() ([]byte, error) {
+	if _, ok := archTable[a]; !ok {
+		return nil, fmt.Errorf("seccomp: unknown architecture %#x", uint32(a))
+	}
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *Arch) UnmarshalText(text []byte) error {
+	for arch, info := range archTable {
+		if info.name == string(text) {
+			*a = arch
+			return nil
+		}
+	}
+	return fmt.Errorf("seccomp: unknown architecture %q", string(text))
+}
+
+// Syscall returns the number of the named syscall on the architecture.
+func (a Arch) Syscall(name string) (int32, bool) {
+	nr, ok := archTable[a].syscalls[name]
+	return nr, ok
+}
+
+// SyscallName returns the name of syscall number nr on the architecture.
+func (a Arch) SyscallName(nr int32) (string, bool) {
+	for name, n := range archTable[a].syscalls {
+		if n == nr {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// NativeArches returns the architectures of the processes that can run on the
+// current system: the architecture of the Go runtime and its compat
+// architectures.
+func NativeArches() []Arch {
+	switch runtime.GOARCH {
+	case "amd64":
+		return []Arch{ArchX86_64, ArchI386}
+	case "386":
+		return []Arch{ArchI386}
+	case "arm64":
+		return []Arch{ArchAARCH64}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,191 @@
+package seccomp_test
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/heroku/dynolab/seccomp"
+	"github.com/heroku/dynolab/seccomp/simulator"
+)
+
+func TestCompileArches(t *testing.T) {
+	profile := &seccomp.Profile{
+		DefaultAction: seccomp.ActAllow,
+		Architectures: []seccomp.Arch{seccomp.ArchX86_64, seccomp.ArchI386, seccomp.ArchAARCH64},
+		Syscalls: []seccomp.Rule{
+			{Names: []string{"unshare", "setns", "mount"}, Action: seccomp.Errno(syscall.EPERM)},
+			{
+				Names:  []string{"personality"},
+				Action: seccomp.ActKill,
+				Args:   []seccomp.Arg{{Index: 0, Op: seccomp.OpEqual, Value: 0x8}},
+			},
+		},
+	}
+
+	prog, err := seccomp.Compile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		arch seccomp.Arch
+		nr   int32
+		args [6]uint64
+		want seccomp.Action
+	}{
+		{seccomp.ArchX86_64, 272, [6]uint64{}, seccomp.Errno(syscall.EPERM)},  // unshare
+		{seccomp.ArchX86_64, 308, [6]uint64{}, seccomp.Errno(syscall.EPERM)},  // setns
+		{seccomp.ArchX86_64, 165, [6]uint64{}, seccomp.Errno(syscall.EPERM)},  // mount
+		{seccomp.ArchX86_64, 0, [6]uint64{}, seccomp.ActAllow},                // read
+		{seccomp.ArchX86_64, 135, [6]uint64{0x8}, seccomp.ActKill},            // personality
+		{seccomp.ArchX86_64, 135, [6]uint64{0x100000008}, seccomp.ActAllow},   // personality
+		{seccomp.ArchX86_64, 0x40000000 | 272, [6]uint64{}, seccomp.ActKill},  // x32 unshare
+		{seccomp.ArchI386, 310, [6]uint64{}, seccomp.Errno(syscall.EPERM)},    // unshare
+		{seccomp.ArchI386, 346, [6]uint64{}, seccomp.Errno(syscall.EPERM)},    // setns
+		{seccomp.ArchI386, 21, [6]uint64{}, seccomp.Errno(syscall.EPERM)},     // mount
+		{seccomp.ArchI386, 272, [6]uint64{}, seccomp.ActAllow},                // fadvise64_64
+		{seccomp.ArchI386, 136, [6]uint64{0x8}, seccomp.ActKill},              // personality
+		{seccomp.ArchAARCH64, 97, [6]uint64{}, seccomp.Errno(syscall.EPERM)},  // unshare
+		{seccomp.ArchAARCH64, 268, [6]uint64{}, seccomp.Errno(syscall.EPERM)}, // setns
+		{seccomp.ArchAARCH64, 40, [6]uint64{}, seccomp.Errno(syscall.EPERM)},  // mount
+		{seccomp.ArchAARCH64, 272, [6]uint64{}, seccomp.ActAllow},             // timerfd_create
+		{seccomp.ArchAARCH64, 92, [6]uint64{0x8}, seccomp.ActKill},            // personality
+		{seccomp.Arch(0x40000028), 310, [6]uint64{}, seccomp.ActKill},         // arm
+	}
+
+	for _, test := range tests {
+		data := simulator.Data{
+			NR:   test.nr,
+			Arch: test.arch,
+			Args: test.args,
+		}
+
+		got, err := simulator.Run(prog, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := test.want; want != got {
+			t.Errorf("%s syscall %d: want action %s, got %s", test.arch, test.nr, want, got)
+		}
+	}
+}
+
+func TestCompileUnknownArchSyscall(t *testing.T) {
+	profile := &seccomp.Profile{
+		DefaultAction: seccomp.ActAllow,
+		Architectures: []seccomp.Arch{seccomp.ArchX86_64, seccomp.ArchAARCH64},
+		Syscalls: []seccomp.Rule{
+			// open is not defined on aarch64
+			{Names: []string{"open"}, Action: seccomp.ActLog},
+		},
+	}
+
+	if _, err := seccomp.Compile(profile); err != nil {
+		t.Fatal(err)
+	}
+
+	profile.Architectures = []seccomp.Arch{seccomp.ArchAARCH64}
+	if _, err := seccomp.Compile(profile); err == nil {
+		t.Fatal("want error for syscall unknown on every architecture")
+	}
+}
+
+func TestCompileFarArchJump(t *testing.T) {
+	// the syscalls are enough to push the x86_64 bad arch jump past the 8-bit
+	// conditional jump offsets.
+	arches := []seccomp.Arch{seccomp.ArchX86_64, seccomp.ArchI386}
+	profile := &seccomp.Profile{
+		DefaultAction: seccomp.ActUserNotif,
+		Architectures: arches,
+		Syscalls: []seccomp.Rule{
+			{Names: seccomp.AuditBaseline, Action: seccomp.ActAllow},
+		},
+	}
+
+	prog, err := seccomp.Compile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(data simulator.Data) seccomp.Action {
+		act, err := simulator.Run(prog, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return act
+	}
+
+	for _, arch := range arches {
+		for _, name := range append(seccomp.AuditBaseline, "mkdir") {
+			data, err := simulator.NewData(arch, name)
+			if err != nil {
+				continue
+			}
+
+			want := seccomp.ActAllow
+			if name == "mkdir" {
+				want = seccomp.ActUserNotif
+			}
+			if got := run(data); want != got {
+				t.Errorf("%s %s: want action %s, got %s", arch, name, want, got)
+			}
+		}
+	}
+
+	x32 := simulator.Data{NR: 0x40000000, Arch: seccomp.ArchX86_64}
+	if want, got := seccomp.ActKill, run(x32); want != got {
+		t.Errorf("x32 read: want action %s, got %s", want, got)
+	}
+}
+
+func TestCompileFarArgJumps(t *testing.T) {
+	// the conditions are enough to push the jumps to the next rule past the
+	// 8-bit conditional jump offsets; each condition falls through to the
+	// next one when it holds.
+	var args []seccomp.Arg
+	for i := 0; i < 100; i++ {
+		args = append(args, seccomp.Arg{Index: uint(i % 6), Op: seccomp.OpGreaterEqual, Value: seccomp.ArgValue(i)})
+	}
+
+	profile := &seccomp.Profile{
+		DefaultAction: seccomp.ActAllow,
+		Architectures: []seccomp.Arch{seccomp.ArchX86_64},
+		Syscalls: []seccomp.Rule{
+			{Names: []string{"read"}, Action: seccomp.ActLog, Args: args},
+			{Names: []string{"write"}, Action: seccomp.Errno(syscall.EPERM)},
+		},
+	}
+
+	prog, err := seccomp.Compile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		nr   int32
+		args [6]uint64
+		want seccomp.Action
+	}{
+		{0, [6]uint64{99, 99, 99, 99, 99, 99}, seccomp.ActLog}, // read
+		{0, [6]uint64{99, 99, 99, 99, 99, 0}, seccomp.ActAllow},
+		{0, [6]uint64{}, seccomp.ActAllow},
+		{1, [6]uint64{}, seccomp.Errno(syscall.EPERM)}, // write
+		{2, [6]uint64{}, seccomp.ActAllow},             // open
+	}
+
+	for _, test := range tests {
+		data := simulator.Data{
+			NR:   test.nr,
+			Arch: seccomp.ArchX86_64,
+			Args: test.args,
+		}
+
+		got, err := simulator.Run(prog, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := test.want; want != got {
+			t.Errorf("syscall %d %v: want action %s, got %s", test.nr, test.args, want, got)
+		}
+	}
+}
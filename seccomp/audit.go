@@ -0,0 +1,197 @@
+package seccomp
+
+import (
+	"sort"
+	"sync"
+	"syscall"
+)
+
+// AuditBaseline are the syscalls allowed without notification by the
+// AuditProfile. They may be called by the Go runtime of the supervising
+// thread without releasing its scheduler context, while the world is stopped,
+// or by a child process before exec while the parent thread is suspended,
+// when a notification would deadlock the process.
+var AuditBaseline = []string{
+	// processes
+	"clone", "clone3", "vfork", "execve", "execveat", "exit", "exit_group",
+	"setpgid", "setsid", "chdir", "dup2", "dup3",
+
+	// threads & signals
+	"restart_syscall",
+	"getpid", "gettid", "kill", "tgkill",
+	"rt_sigaction", "rt_sigprocmask", "rt_sigreturn", "sigreturn", "sigaltstack",
+	"arch_prctl", "set_thread_area",
+
+	// memory
+	"brk", "mmap", "mmap2", "munmap", "madvise", "mincore",
+
+	// scheduling & time
+	"futex", "futex_time64", "sched_yield", "sched_getaffinity",
+	"nanosleep", "clock_nanosleep", "clock_nanosleep_time64",
+	"clock_gettime", "clock_gettime64", "gettimeofday",
+	"setitimer", "timer_create", "timer_settime", "timer_settime64", "timer_delete",
+
+	// network poller
+	"epoll_create1", "epoll_ctl", "epoll_pwait", "epoll_wait", "eventfd2",
+	"pipe2", "fcntl", "fcntl64", "read", "write", "close",
+
+	// resource limits
+	"getrlimit", "ugetrlimit", "prlimit64",
+
+	// credentials, which are set on all threads with the world stopped
+	"setuid", "setgid", "setreuid", "setregid", "setresuid", "setresgid",
+	"setfsuid", "setfsgid", "setgroups",
+	"setuid32", "setgid32", "setreuid32", "setregid32", "setresuid32", "setresgid32",
+	"setfsuid32", "setfsgid32", "setgroups32",
+}
+
+// AuditProfile returns the profile of an Auditor for the native
+// architectures: syscalls other than the AuditBaseline are notified.
+func AuditProfile() *Profile {
+	return &Profile{
+		DefaultAction: ActUserNotif,
+		Syscalls: []Rule{
+			{Names: baselineSyscalls(NativeArches()), Action: ActAllow},
+		},
+	}
+}
+
+// baselineSyscalls returns the AuditBaseline syscalls defined on any of the
+// arches.
+func baselineSyscalls(arches []Arch) []string {
+	var names []string
+	for _, name := range AuditBaseline {
+		if hasSyscall(arches, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Auditor is a Handler counting the syscalls of the filtered processes, and
+// allowing them. It is loaded with the AuditProfile to profile the syscalls
+// used by an application.
+type Auditor struct {
+	// IgnorePid is the thread whose syscalls are allowed without being
+	// counted, e.g. the supervising thread loading the program.
+	IgnorePid int
+
+	mu     sync.Mutex
+	counts map[auditKey]uint64
+}
+
+type auditKey struct {
+	arch Arch
+	nr   int32
+}
+
+// Notify implements Handler.
+func (a *Auditor) Notify(n *Notification) Response {
+	if n.Pid == a.IgnorePid {
+		return Allow()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.counts == nil {
+		a.counts = make(map[auditKey]uint64)
+	}
+	a.counts[auditKey{arch: n.Arch, nr: n.NR}]++
+
+	return Allow()
+}
+
+// Report returns the syscall histogram counted so far.
+func (a *Auditor) Report() *AuditReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	r := &AuditReport{
+		Syscalls:  make([]SyscallCount, 0, len(a.counts)),
+		Uncounted: baselineSyscalls(NativeArches()),
+	}
+	for key, count := range a.counts {
+		name, _ := key.arch.SyscallName(key.nr)
+		r.Syscalls = append(r.Syscalls, SyscallCount{
+			Arch:  key.arch,
+			Name:  name,
+			NR:    key.nr,
+			Count: count,
+		})
+	}
+
+	sort.Slice(r.Syscalls, func(i, j int) bool {
+		si, sj := r.Syscalls[i], r.Syscalls[j]
+		switch {
+		case si.Count != sj.Count:
+			return si.Count > sj.Count
+		case si.Arch != sj.Arch:
+			return si.Arch < sj.Arch
+		default:
+			return si.NR < sj.NR
+		}
+	})
+	return r
+}
+
+// AuditReport is the syscall histogram of an Auditor, in descending count
+// order. The AuditBaseline syscalls are not notified, so they are listed as
+// Uncounted rather than in the histogram.
+type AuditReport struct {
+	Syscalls  []SyscallCount `json:"syscalls"`
+	Uncounted []string       `json:"uncounted"`
+}
+
+// SyscallCount is the number of calls of a syscall. The name is empty if the
+// syscall number is unknown.
+type SyscallCount struct {
+	Arch  Arch   `json:"arch"`
+	Name  string `json:"name,omitempty"`
+	NR    int32  `json:"nr"`
+	Count uint64 `json:"count"`
+}
+
+// Profile returns an allow-list profile of the audited syscalls and the
+// AuditBaseline, for the audited architectures. Other syscalls fail with
+// EPERM.
+func (r *AuditReport) Profile() *Profile {
+	var (
+		arches []Arch
+		names  []string
+
+		seenArches = make(map[Arch]bool)
+		seenNames  = make(map[string]bool)
+	)
+	for _, sc := range r.Syscalls {
+		if _, ok := archTable[sc.Arch]; ok && !seenArches[sc.Arch] {
+			seenArches[sc.Arch] = true
+			arches = append(arches, sc.Arch)
+		}
+		if sc.Name != "" && !seenNames[sc.Name] {
+			seenNames[sc.Name] = true
+			names = append(names, sc.Name)
+		}
+	}
+	if len(arches) == 0 {
+		arches = NativeArches()
+	}
+
+	for _, name := range baselineSyscalls(arches) {
+		if !seenNames[name] {
+			seenNames[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Slice(arches, func(i, j int) bool { return arches[i] < arches[j] })
+	sort.Strings(names)
+
+	return &Profile{
+		DefaultAction: Errno(syscall.EPERM),
+		Architectures: arches,
+		Syscalls: []Rule{
+			{Names: names, Action: ActAllow},
+		},
+	}
+}
@@ -0,0 +1,90 @@
+package seccomp
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestAuditor(t *testing.T) {
+	a := &Auditor{IgnorePid: 1}
+
+	notifs := []*Notification{
+		{Pid: 2, Arch: ArchX86_64, NR: 0},   // read
+		{Pid: 2, Arch: ArchX86_64, NR: 83},  // mkdir
+		{Pid: 3, Arch: ArchX86_64, NR: 83},  // mkdir
+		{Pid: 3, Arch: ArchI386, NR: 39},    // mkdir
+		{Pid: 1, Arch: ArchX86_64, NR: 165}, // mount
+		{Pid: 2, Arch: ArchX86_64, NR: 9999},
+	}
+	for _, n := range notifs {
+		if want, got := Allow(), a.Notify(n); want != got {
+			t.Fatalf("want response %+v, got %+v", want, got)
+		}
+	}
+
+	want := &AuditReport{
+		Syscalls: []SyscallCount{
+			{Arch: ArchX86_64, Name: "mkdir", NR: 83, Count: 2},
+			{Arch: ArchI386, Name: "mkdir", NR: 39, Count: 1},
+			{Arch: ArchX86_64, Name: "read", NR: 0, Count: 1},
+			{Arch: ArchX86_64, NR: 9999, Count: 1},
+		},
+		Uncounted: baselineSyscalls(NativeArches()),
+	}
+	if got := a.Report(); !reflect.DeepEqual(want, got) {
+		t.Fatalf("want report %+v, got %+v", want, got)
+	}
+
+	uncounted := make(map[string]bool)
+	for _, name := range a.Report().Uncounted {
+		uncounted[name] = true
+	}
+	for _, name := range []string{"futex", "read", "execve"} {
+		if !uncounted[name] {
+			t.Errorf("want baseline syscall %s to be reported as uncounted", name)
+		}
+	}
+}
+
+func TestAuditReportProfile(t *testing.T) {
+	report := &AuditReport{
+		Syscalls: []SyscallCount{
+			{Arch: ArchX86_64, Name: "mkdir", NR: 83, Count: 2},
+			{Arch: ArchX86_64, Name: "open", NR: 2, Count: 1},
+		},
+	}
+
+	profile := report.Profile()
+	if want, got := []Arch{ArchX86_64}, profile.Architectures; !reflect.DeepEqual(want, got) {
+		t.Errorf("want architectures %v, got %v", want, got)
+	}
+	if want, got := Errno(syscall.EPERM), profile.DefaultAction; want != got {
+		t.Errorf("want default action %s, got %s", want, got)
+	}
+
+	allowed := make(map[string]bool)
+	for _, name := range profile.Syscalls[0].Names {
+		allowed[name] = true
+	}
+	for _, name := range []string{"mkdir", "open", "futex", "setresuid"} {
+		if !allowed[name] {
+			t.Errorf("want syscall %s to be allowed", name)
+		}
+	}
+	for _, name := range []string{"mmap2", "unshare"} {
+		if allowed[name] {
+			t.Errorf("want syscall %s to be denied", name)
+		}
+	}
+
+	if err := profile.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditProfile(t *testing.T) {
+	if err := AuditProfile().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
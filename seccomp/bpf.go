@@ -0,0 +1,231 @@
+package seccomp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Instruction is a classic BPF instruction. It has the memory layout of
+// struct sock_filter.
+type Instruction struct {
+	Code   uint16
+	Jt, Jf uint8
+	K      uint32
+}
+
+// Program is a seccomp BPF filter program.
+type Program []Instruction
+
+// String returns the disassembled program, one instruction per line, with
+// absolute jump targets.
+func (p Program) String() string {
+	var b strings.Builder
+	for i, insn := range p {
+		fmt.Fprintf(&b, "%04d: %s\n", i, insn.disassemble(i))
+	}
+	return b.String()
+}
+
+func (insn Instruction) disassemble(pc int) string {
+	jt, jf := pc+1+int(insn.Jt), pc+1+int(insn.Jf)
+
+	switch insn.Code {
+	case bpfLD | bpfW | bpfABS:
+		return fmt.Sprintf("ld [%d]", insn.K)
+	case bpfALU | bpfAND | bpfK:
+		return fmt.Sprintf("and #%#x", insn.K)
+	case bpfJMP | bpfJA:
+		return fmt.Sprintf("ja %04d", pc+1+int(insn.K))
+	case bpfJMP | bpfJEQ | bpfK:
+		return fmt.Sprintf("jeq #%#x jt %04d jf %04d", insn.K, jt, jf)
+	case bpfJMP | bpfJGT | bpfK:
+		return fmt.Sprintf("jgt #%#x jt %04d jf %04d", insn.K, jt, jf)
+	case bpfJMP | bpfJGE | bpfK:
+		return fmt.Sprintf("jge #%#x jt %04d jf %04d", insn.K, jt, jf)
+	case bpfJMP | bpfJSET | bpfK:
+		return fmt.Sprintf("jset #%#x jt %04d jf %04d", insn.K, jt, jf)
+	case bpfRET | bpfK:
+		return "ret " + Action(insn.K).String()
+	default:
+		return fmt.Sprintf("unknown code=%#x jt=%d jf=%d k=%#x", insn.Code, insn.Jt, insn.Jf, insn.K)
+	}
+}
+
+// BPF instruction codes. See include/uapi/linux/filter.h in Linux.
+const (
+	bpfLD  = 0x00
+	bpfALU = 0x04
+	bpfJMP = 0x05
+	bpfRET = 0x06
+
+	bpfW   = 0x00
+	bpfABS = 0x20
+
+	bpfAND = 0x50
+
+	bpfJA   = 0x00
+	bpfJEQ  = 0x10
+	bpfJGT  = 0x20
+	bpfJGE  = 0x30
+	bpfJSET = 0x40
+
+	bpfK = 0x00
+
+	bpfMaxInsns = 4096
+)
+
+// struct seccomp_data offsets. See include/uapi/linux/seccomp.h in Linux.
+const (
+	offsetNR   = 0
+	offsetArch = 4
+	offsetIP   = 8
+	offsetArgs = 16
+)
+
+var errProgramTooLong = errors.New("seccomp: program too long")
+
+// label is a symbolic jump target of an assembler instruction.
+type label int
+
+// next is the label of the following instruction.
+const next label = -1
+
+type asmInstruction struct {
+	Instruction
+
+	jt, jf label
+}
+
+// assembler emits instructions with symbolic jump targets and resolves them
+// into a Program.
+type assembler struct {
+	insns  []asmInstruction
+	labels []int
+}
+
+func (a *assembler) newLabel() label {
+	a.labels = append(a.labels, -1)
+	return label(len(a.labels) - 1)
+}
+
+// bind sets the target of l to the next emitted instruction.
+func (a *assembler) bind(l label) {
+	a.labels[l] = len(a.insns)
+}
+
+func (a *assembler) emit(code uint16, k uint32, jt, jf label) {
+	a.insns = append(a.insns, asmInstruction{
+		Instruction: Instruction{Code: code, K: k},
+		jt:          jt,
+		jf:          jf,
+	})
+}
+
+func (a *assembler) ld(offset uint32) { a.emit(bpfLD|bpfW|bpfABS, offset, next, next) }
+func (a *assembler) and(k uint32)     { a.emit(bpfALU|bpfAND|bpfK, k, next, next) }
+func (a *assembler) ret(k uint32)     { a.emit(bpfRET|bpfK, k, next, next) }
+func (a *assembler) ja(l label)       { a.emit(bpfJMP|bpfJA, 0, l, next) }
+
+func (a *assembler) jmp(op uint16, k uint32, jt, jf label) {
+	a.emit(bpfJMP|op|bpfK, k, jt, jf)
+}
+
+// assemble resolves the jump targets. Conditional jumps are limited to 255
+// instructions, farther targets are reached through an inserted trampoline
+// (unconditional jump) instruction.
+func (a *assembler) assemble() (Program, error) {
+	for {
+		i, far := a.farJump()
+		if i < 0 {
+			break
+		}
+
+		// the branch falling through to the next instruction must skip the
+		// trampoline.
+		if insn := &a.insns[i]; insn.jt == next || insn.jf == next {
+			l := a.newLabel()
+			a.labels[l] = i + 1
+			if insn.jt == next {
+				insn.jt = l
+			} else {
+				insn.jf = l
+			}
+		}
+
+		tramp := a.newLabel()
+		a.insert(i+1, asmInstruction{
+			Instruction: Instruction{Code: bpfJMP | bpfJA},
+			jt:          far,
+			jf:          next,
+		})
+		a.labels[tramp] = i + 1
+
+		if insn := &a.insns[i]; insn.jt == far {
+			insn.jt = tramp
+		} else {
+			insn.jf = tramp
+		}
+	}
+
+	if len(a.insns) > bpfMaxInsns {
+		return nil, errProgramTooLong
+	}
+
+	prog := make(Program, len(a.insns))
+	for i, insn := range a.insns {
+		prog[i] = insn.Instruction
+
+		if insn.Code&0x07 != bpfJMP {
+			continue
+		}
+		if insn.Code&0xf0 == bpfJA {
+			prog[i].K = uint32(a.offset(i, insn.jt))
+			continue
+		}
+		prog[i].Jt = uint8(a.offset(i, insn.jt))
+		prog[i].Jf = uint8(a.offset(i, insn.jf))
+	}
+	return prog, nil
+}
+
+// farJump returns the index and target of the first conditional jump that
+// exceeds the range of its jump offset.
+func (a *assembler) farJump() (int, label) {
+	for i, insn := range a.insns {
+		if insn.Code&0x07 != bpfJMP || insn.Code&0xf0 == bpfJA {
+			continue
+		}
+		if a.offset(i, insn.jt) > 0xff {
+			return i, insn.jt
+		}
+		if a.offset(i, insn.jf) > 0xff {
+			return i, insn.jf
+		}
+	}
+	return -1, next
+}
+
+func (a *assembler) offset(i int, l label) int {
+	if l == next {
+		return 0
+	}
+
+	pos := a.labels[l]
+	if pos <= i {
+		panic("seccomp: backward jump")
+	}
+	return pos - i - 1
+}
+
+func (a *assembler) insert(i int, insn asmInstruction) {
+	a.insns = append(a.insns, asmInstruction{})
+	copy(a.insns[i+1:], a.insns[i:])
+	a.insns[i] = insn
+
+	for l, pos := range a.labels {
+		if pos >= i {
+			a.labels[l] = pos + 1
+		}
+	}
+}
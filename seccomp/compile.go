@@ -0,0 +1,290 @@
+package seccomp
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const x32SyscallBit = 0x40000000
+
+// linearSearchLen is the maximum number of syscalls dispatched by a linear
+// sequence of comparisons, larger sets are split by a binary search.
+const linearSearchLen = 4
+
+var errNoArches = errors.New("seccomp: no supported architecture")
+
+// syscallRules are the rules of a single syscall.
+type syscallRules struct {
+	nr    int32
+	rules []Rule
+	body  label
+}
+
+// Compile translates p into a seccomp BPF program. The program checks the
+// architecture of each syscall, then dispatches on the syscall number with a
+// binary search, followed by the argument comparisons of each syscall's rules.
+// Processes calling syscalls of any other architecture (or the x32 ABI) are
+// killed.
+//
+// Syscall names must be defined on at least one of the profile's
+// architectures, rules are skipped on the architectures lacking the syscall.
+func Compile(p *Profile) (Program, error) {
+	if err := checkAction(p.DefaultAction); err != nil {
+		return nil, err
+	}
+	for _, rule := range p.Syscalls {
+		if err := checkAction(rule.Action); err != nil {
+			return nil, err
+		}
+	}
+
+	arches := p.Architectures
+	if len(arches) == 0 {
+		arches = NativeArches()
+	}
+	if len(arches) == 0 {
+		return nil, errNoArches
+	}
+
+	for _, rule := range p.Syscalls {
+		for _, name := range rule.Names {
+			if !hasSyscall(arches, name) {
+				return nil, fmt.Errorf("seccomp: unknown syscall %q", name)
+			}
+		}
+	}
+
+	a := new(assembler)
+	badArch := a.newLabel()
+
+	a.ld(offsetArch)
+	for i, arch := range arches {
+		info, ok := archTable[arch]
+		if !ok {
+			return nil, fmt.Errorf("seccomp: unknown architecture %s", arch)
+		}
+
+		nextArch := badArch
+		if i < len(arches)-1 {
+			nextArch = a.newLabel()
+		}
+
+		a.jmp(bpfJEQ, uint32(arch), next, nextArch)
+		if err := compileArch(a, info, p, badArch); err != nil {
+			return nil, err
+		}
+
+		if nextArch != badArch {
+			a.bind(nextArch)
+		}
+	}
+
+	a.bind(badArch)
+	a.ret(uint32(ActKill))
+
+	return a.assemble()
+}
+
+func hasSyscall(arches []Arch, name string) bool {
+	for _, arch := range arches {
+		if _, ok := arch.Syscall(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compileArch emits the syscall dispatch & rules of p for a single
+// architecture. Every path ends in a return instruction.
+func compileArch(a *assembler, info archInfo, p *Profile, badArch label) error {
+	var (
+		syscalls []*syscallRules
+		index    = map[int32]*syscallRules{}
+	)
+
+	for _, rule := range p.Syscalls {
+		for _, name := range rule.Names {
+			nr, ok := info.syscalls[name]
+			if !ok {
+				continue
+			}
+
+			sr, ok := index[nr]
+			if !ok {
+				sr = &syscallRules{nr: nr, body: a.newLabel()}
+				index[nr] = sr
+				syscalls = append(syscalls, sr)
+			}
+			sr.rules = append(sr.rules, rule)
+		}
+	}
+	sort.Slice(syscalls, func(i, j int) bool { return syscalls[i].nr < syscalls[j].nr })
+
+	a.ld(offsetNR)
+	if info.syscallMask != 0 {
+		a.jmp(bpfJGE, info.syscallMask, badArch, next)
+	}
+
+	compileSearch(a, syscalls, p.DefaultAction)
+
+	for _, sr := range syscalls {
+		a.bind(sr.body)
+		if err := compileRules(a, sr.rules, p.DefaultAction, info.is32bit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileSearch emits a binary search over the sorted syscalls, jumping to
+// the body of the matching syscall. The syscall number must be loaded.
+func compileSearch(a *assembler, syscalls []*syscallRules, defaultAction Action) {
+	if len(syscalls) <= linearSearchLen {
+		for _, sr := range syscalls {
+			a.jmp(bpfJEQ, uint32(sr.nr), sr.body, next)
+		}
+		a.ret(uint32(defaultAction))
+		return
+	}
+
+	mid := len(syscalls) / 2
+	upper := a.newLabel()
+
+	a.jmp(bpfJGE, uint32(syscalls[mid].nr), upper, next)
+	compileSearch(a, syscalls[:mid], defaultAction)
+	a.bind(upper)
+	compileSearch(a, syscalls[mid:], defaultAction)
+}
+
+// compileRules emits the rules of a single syscall. The rules are tried in
+// order, if none match the default action is returned.
+func compileRules(a *assembler, rules []Rule, defaultAction Action, is32bit bool) error {
+	for _, rule := range rules {
+		if len(rule.Args) == 0 {
+			a.ret(uint32(rule.Action))
+			return nil
+		}
+
+		nextRule := a.newLabel()
+		for _, arg := range rule.Args {
+			if err := compileArg(a, arg, nextRule, is32bit); err != nil {
+				return err
+			}
+		}
+		a.ret(uint32(rule.Action))
+		a.bind(nextRule)
+	}
+
+	a.ret(uint32(defaultAction))
+	return nil
+}
+
+// compileArg emits a 64-bit comparison of a syscall argument as a pair of
+// 32-bit comparisons, high word first. Only the low word is compared on
+// 32-bit architectures, where values with the high word set are rejected.
+// Execution continues with the next instruction if the
+// condition holds, and jumps to fail otherwise.
+func compileArg(a *assembler, arg Arg, fail label, is32bit bool) error {
+	if arg.Index > 5 {
+		return errTooManyArgs
+	}
+
+	var (
+		lo, hi   = offsetArgs + 8*uint32(arg.Index), offsetArgs + 8*uint32(arg.Index) + 4
+		vlo, vhi = uint32(arg.Value), uint32(arg.Value >> 32)
+		pass     = a.newLabel()
+	)
+
+	if is32bit {
+		if vhi != 0 {
+			return fmt.Errorf("seccomp: argument value %#x out of range on 32-bit architectures", arg.Value)
+		}
+
+		switch arg.Op {
+		case OpEqual:
+			a.ld(lo)
+			a.jmp(bpfJEQ, vlo, pass, fail)
+		case OpNotEqual:
+			a.ld(lo)
+			a.jmp(bpfJEQ, vlo, fail, pass)
+		case OpGreater:
+			a.ld(lo)
+			a.jmp(bpfJGT, vlo, pass, fail)
+		case OpGreaterEqual:
+			a.ld(lo)
+			a.jmp(bpfJGE, vlo, pass, fail)
+		case OpLess:
+			a.ld(lo)
+			a.jmp(bpfJGE, vlo, fail, pass)
+		case OpLessEqual:
+			a.ld(lo)
+			a.jmp(bpfJGT, vlo, fail, pass)
+		case OpMaskedEqual:
+			a.ld(lo)
+			a.and(uint32(arg.Mask))
+			a.jmp(bpfJEQ, vlo, pass, fail)
+		default:
+			return fmt.Errorf("seccomp: unknown operator %s", arg.Op)
+		}
+
+		a.bind(pass)
+		return nil
+	}
+
+	switch arg.Op {
+	case OpEqual:
+		a.ld(hi)
+		a.jmp(bpfJEQ, vhi, next, fail)
+		a.ld(lo)
+		a.jmp(bpfJEQ, vlo, pass, fail)
+	case OpNotEqual:
+		a.ld(hi)
+		a.jmp(bpfJEQ, vhi, next, pass)
+		a.ld(lo)
+		a.jmp(bpfJEQ, vlo, fail, pass)
+	case OpGreater:
+		a.ld(hi)
+		a.jmp(bpfJGT, vhi, pass, next)
+		a.jmp(bpfJEQ, vhi, next, fail)
+		a.ld(lo)
+		a.jmp(bpfJGT, vlo, pass, fail)
+	case OpGreaterEqual:
+		a.ld(hi)
+		a.jmp(bpfJGT, vhi, pass, next)
+		a.jmp(bpfJEQ, vhi, next, fail)
+		a.ld(lo)
+		a.jmp(bpfJGE, vlo, pass, fail)
+	case OpLess:
+		a.ld(hi)
+		a.jmp(bpfJGT, vhi, fail, next)
+		a.jmp(bpfJEQ, vhi, next, pass)
+		a.ld(lo)
+		a.jmp(bpfJGE, vlo, fail, pass)
+	case OpLessEqual:
+		a.ld(hi)
+		a.jmp(bpfJGT, vhi, fail, next)
+		a.jmp(bpfJEQ, vhi, next, pass)
+		a.ld(lo)
+		a.jmp(bpfJGT, vlo, fail, pass)
+	case OpMaskedEqual:
+		a.ld(hi)
+		a.and(uint32(arg.Mask >> 32))
+		a.jmp(bpfJEQ, vhi, next, fail)
+		a.ld(lo)
+		a.and(uint32(arg.Mask))
+		a.jmp(bpfJEQ, vlo, pass, fail)
+	default:
+		return fmt.Errorf("seccomp: unknown operator %s", arg.Op)
+	}
+
+	a.bind(pass)
+	return nil
+}
+
+func checkAction(act Action) error {
+	if _, ok := actionNames[act&actionMask]; !ok {
+		return fmt.Errorf("seccomp: unknown action %s", act)
+	}
+	return nil
+}
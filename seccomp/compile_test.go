@@ -0,0 +1,283 @@
+package seccomp
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestCompileDefaultProfile(t *testing.T) {
+	profile := *DefaultProfile
+	profile.Architectures = []Arch{ArchX86_64}
+
+	prog, err := Compile(&profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Program{
+		{Code: bpfLD | bpfW | bpfABS, K: offsetArch},
+		{Code: bpfJMP | bpfJEQ | bpfK, Jt: 0, Jf: 5, K: uint32(ArchX86_64)},
+		{Code: bpfLD | bpfW | bpfABS, K: offsetNR},
+		{Code: bpfJMP | bpfJGE | bpfK, Jt: 3, Jf: 0, K: x32SyscallBit},
+		{Code: bpfJMP | bpfJEQ | bpfK, Jt: 1, Jf: 0, K: 272},
+		{Code: bpfRET | bpfK, K: uint32(ActAllow)},
+		{Code: bpfRET | bpfK, K: uint32(Errno(syscall.EPERM))},
+		{Code: bpfRET | bpfK, K: uint32(ActKill)},
+	}
+	if !reflect.DeepEqual(want, prog) {
+		t.Errorf("want program %v, got %v", want, prog)
+	}
+}
+
+func TestCompileBinarySearch(t *testing.T) {
+	names := []string{"read", "write", "open", "close", "stat", "fstat", "lstat", "poll", "lseek", "mmap"}
+
+	profile := &Profile{
+		DefaultAction: ActAllow,
+		Architectures: []Arch{ArchX86_64},
+		Syscalls: []Rule{
+			{Names: names, Action: ActLog},
+		},
+	}
+
+	prog, err := Compile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// syscalls 0-9 are split as [0-4] [5-9], then [0-1] [2-4] & [5-6] [7-9]
+
+	var pivots []uint32
+	for _, insn := range prog[4:] {
+		if insn.Code == bpfJMP|bpfJGE|bpfK {
+			pivots = append(pivots, insn.K)
+		}
+	}
+
+	if want, got := []uint32{5, 2, 7}, pivots; !reflect.DeepEqual(want, got) {
+		t.Errorf("want binary search pivots %v, got %v", want, got)
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile *Profile
+		err     string
+	}{
+		{
+			name: "unknown syscall",
+			profile: &Profile{
+				DefaultAction: ActAllow,
+				Syscalls:      []Rule{{Names: []string{"frobnicate"}, Action: ActKill}},
+			},
+			err: `unknown syscall "frobnicate"`,
+		},
+		{
+			name: "unknown action",
+			profile: &Profile{
+				DefaultAction: Action(0x12340000),
+			},
+			err: "unknown action",
+		},
+		{
+			name: "argument index",
+			profile: &Profile{
+				DefaultAction: ActAllow,
+				Syscalls: []Rule{{
+					Names:  []string{"mount"},
+					Action: ActKill,
+					Args:   []Arg{{Index: 6, Op: OpEqual}},
+				}},
+			},
+			err: "argument index out of range",
+		},
+		{
+			name: "unknown operator",
+			profile: &Profile{
+				DefaultAction: ActAllow,
+				Syscalls: []Rule{{
+					Names:  []string{"mount"},
+					Action: ActKill,
+					Args:   []Arg{{Index: 0}},
+				}},
+			},
+			err: "unknown operator",
+		},
+		{
+			name: "32-bit argument value",
+			profile: &Profile{
+				DefaultAction: ActAllow,
+				Architectures: []Arch{ArchI386},
+				Syscalls: []Rule{{
+					Names:  []string{"close"},
+					Action: ActKill,
+					Args:   []Arg{{Index: 0, Op: OpEqual, Value: 0x100000008}},
+				}},
+			},
+			err: "out of range on 32-bit architectures",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Compile(test.profile)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("want error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestCompileFarJumps(t *testing.T) {
+	// each condition is 4-5 instructions, enough to push the jumps past the
+	// 8-bit conditional jump offsets.
+
+	var args []Arg
+	for i := 0; i < 100; i++ {
+		args = append(args, Arg{Index: uint(i % 6), Op: OpGreaterEqual, Value: ArgValue(i)})
+	}
+
+	profile := &Profile{
+		DefaultAction: ActAllow,
+		Syscalls: []Rule{
+			{Names: []string{"read"}, Action: ActLog, Args: args},
+			{Names: []string{"write"}, Action: Errno(syscall.EPERM)},
+		},
+	}
+
+	prog, err := Compile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, insn := range prog {
+		if insn.Code&0x07 != bpfJMP {
+			continue
+		}
+
+		targets := []int{i + 1 + int(insn.Jt), i + 1 + int(insn.Jf)}
+		if insn.Code&0xf0 == bpfJA {
+			targets = []int{i + 1 + int(insn.K)}
+		}
+		for _, target := range targets {
+			if target >= len(prog) {
+				t.Fatalf("instruction %d jumps past the end of the program", i)
+			}
+		}
+	}
+
+	if want, got := uint32(ActKill), prog[len(prog)-1].K; want != got {
+		t.Errorf("want last instruction to return %#x, got %#x", want, got)
+	}
+}
+
+func TestAssembleFarJumpFallThrough(t *testing.T) {
+	// the jump falls through when true and is out of range when false: the
+	// true branch must skip the inserted trampoline.
+	var a assembler
+	far := a.newLabel()
+	a.ld(offsetNR)
+	a.jmp(bpfJEQ, 1, next, far)
+	a.ret(uint32(ActLog))
+	for i := 0; i < 300; i++ {
+		a.ret(uint32(ActAllow))
+	}
+	a.bind(far)
+	a.ret(uint32(ActKill))
+
+	prog, err := a.assemble()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// follow returns the action reached from the jump at pc.
+	follow := func(pc int) Action {
+		for prog[pc].Code == bpfJMP|bpfJA {
+			pc += 1 + int(prog[pc].K)
+		}
+		if prog[pc].Code != bpfRET|bpfK {
+			t.Fatalf("want return at %d, got %s", pc, prog[pc].disassemble(pc))
+		}
+		return Action(prog[pc].K)
+	}
+
+	jeq := prog[1]
+	if want, got := ActLog, follow(2+int(jeq.Jt)); want != got {
+		t.Errorf("want true branch to return %s, got %s", want, got)
+	}
+	if want, got := ActKill, follow(2+int(jeq.Jf)); want != got {
+		t.Errorf("want false branch to return %s, got %s", want, got)
+	}
+}
+
+func TestProfileJSON(t *testing.T) {
+	data := []byte(`{
+		"default_action": "allow",
+		"syscalls": [
+			{"names": ["unshare", "setns"], "action": "errno(1)"},
+			{"names": ["mount"], "action": "log", "args": [{"index": 3, "op": "masked_eq", "mask": 1, "value": 1}]}
+		]
+	}`)
+
+	var p Profile
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Profile{
+		DefaultAction: ActAllow,
+		Syscalls: []Rule{
+			{Names: []string{"unshare", "setns"}, Action: Errno(syscall.EPERM)},
+			{Names: []string{"mount"}, Action: ActLog, Args: []Arg{{Index: 3, Op: OpMaskedEqual, Mask: 1, Value: 1}}},
+		},
+	}
+	if !reflect.DeepEqual(want, p) {
+		t.Fatalf("want profile %+v, got %+v", want, p)
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p2 Profile
+	if err := json.Unmarshal(data, &p2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(p, p2) {
+		t.Fatalf("want round-tripped profile %+v, got %+v", p, p2)
+	}
+}
+
+func TestArgValueText(t *testing.T) {
+	for _, tt := range []struct {
+		text string
+		want ArgValue
+	}{
+		{"0", 0},
+		{"8", 8},
+		{"0x8", 8},
+		{"0XFF", 0xff},
+		{"18446744073709551615", 0xffffffffffffffff},
+		{"0xffffffffffffffff", 0xffffffffffffffff},
+	} {
+		var got ArgValue
+		if err := got.UnmarshalText([]byte(tt.text)); err != nil {
+			t.Fatalf("%s: %v", tt.text, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: want value %#x, got %#x", tt.text, tt.want, got)
+		}
+	}
+
+	for _, text := range []string{"", "-1", "0x", "0x10000000000000000", "1e3"} {
+		var v ArgValue
+		if err := v.UnmarshalText([]byte(text)); err == nil {
+			t.Fatalf("%q: want error, got value %#x", text, v)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package seccomp
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// ErrNotificationInvalid indicates the process of a notification is no
+// longer waiting for a response, e.g. because it was killed.
+var ErrNotificationInvalid = errors.New("seccomp: notification is no longer valid")
+
+// Handler responds to the syscalls of the processes filtered by a program
+// loaded with LoadListener. Handlers are called concurrently, one goroutine
+// per notification, and the syscall blocks until the handler returns.
+type Handler interface {
+	Notify(n *Notification) Response
+}
+
+// HandlerFunc is an adapter to allow the use of ordinary functions as
+// notification handlers.
+type HandlerFunc func(n *Notification) Response
+
+// Notify calls f(n).
+func (f HandlerFunc) Notify(n *Notification) Response { return f(n) }
+
+// Notification is a syscall of a filtered process matching an ActUserNotif
+// rule. It corresponds to struct seccomp_notif.
+type Notification struct {
+	ID  uint64
+	Pid int
+
+	NR                 int32
+	Arch               Arch
+	InstructionPointer uint64
+	Args               [6]uint64
+
+	l *Listener
+}
+
+// Syscall returns the name of the notified syscall, or an empty string if the
+// syscall number is unknown.
+func (n *Notification) Syscall() string {
+	name, _ := n.Arch.SyscallName(n.NR)
+	return name
+}
+
+// Response is the result of a notified syscall. It corresponds to struct
+// seccomp_notif_resp.
+type Response struct {
+	// Val is the return value of a successful syscall.
+	Val int64
+
+	// Errno fails the syscall, if set.
+	Errno syscall.Errno
+
+	// Continue executes the syscall in the process as if it was allowed by
+	// the filter. Syscall arguments read from the process memory by the
+	// handler may have been changed since: Continue must not be used to
+	// enforce a policy on pointer arguments.
+	Continue bool
+}
+
+// Allow returns a Response executing the syscall in the process.
+func Allow() Response { return Response{Continue: true} }
+
+// Deny returns a Response failing the syscall with errno, without executing
+// it.
+func Deny(errno syscall.Errno) Response { return Response{Errno: errno} }
+
+// Return returns a Response emulating a successful syscall returning val,
+// without executing it.
+func Return(val int64) Response { return Response{Val: val} }
+
+// Listener receives the notifications of a seccomp program and responds with
+// its Handler. Notifications are received as soon as the program is loaded,
+// as the loading thread itself may be notified. It is run as an actor, and
+// must be stopped once the filtered processes have exited.
+type Listener struct {
+	Handler Handler
+
+	f *os.File
+
+	mu    sync.Mutex
+	err   error
+	donec chan struct{}
+
+	serveErr error
+	servedc  chan struct{}
+}
+
+// Run blocks until the listener is stopped, or until no process is filtered
+// by the program anymore.
+func (l *Listener) Run() error {
+	<-l.servedc
+	return l.serveErr
+}
+
+// Stop closes the listener, causing Run to return. Syscalls waiting for a
+// response, and any further notified syscalls, fail with ENOSYS.
+func (l *Listener) Stop(error) {
+	l.fail(nil)
+}
+
+// fail closes the listener, Run returns err if it is the first failure.
+func (l *Listener) fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.donec:
+		return
+	default:
+	}
+
+	l.err = err
+	close(l.donec)
+	l.f.Close()
+}
+
+func (l *Listener) closed() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.donec:
+		return true, l.err
+	default:
+		return false, nil
+	}
+}
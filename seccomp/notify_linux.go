@@ -0,0 +1,254 @@
+package seccomp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// seccomp user notification ioctls. See include/uapi/linux/seccomp.h in Linux.
+const (
+	ioctlNotifRecv    = 0xc0502100
+	ioctlNotifSend    = 0xc0182101
+	ioctlNotifIDValid = 0x40082102
+
+	userNotifFlagContinue = 0x1
+)
+
+const pageSize = 4096
+
+// errListenerHup indicates no process is filtered by the listener's program
+// anymore.
+var errListenerHup = errors.New("seccomp: listener hung up")
+
+type seccompData struct {
+	nr   int32
+	arch uint32
+	ip   uint64
+	args [6]uint64
+}
+
+type seccompNotif struct {
+	id    uint64
+	pid   uint32
+	flags uint32
+	data  seccompData
+}
+
+type seccompNotifResp struct {
+	id    uint64
+	val   int64
+	error int32
+	flags uint32
+}
+
+// LoadListener sets the seccomp program prog for the local system thread,
+// and returns the listener of its ActUserNotif syscalls. The listener is
+// owned by the calling process and is not inherited by child processes.
+func LoadListener(prog Program, h Handler) (*Listener, error) {
+	fd, err := load(prog.SockFprog(), seccompFilterFlagNewListener)
+	if err != nil {
+		return nil, err
+	}
+
+	// a non-blocking fd is registered with the runtime poller.
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	l := &Listener{
+		Handler: h,
+		f:       os.NewFile(uintptr(fd), "seccomp-listener"),
+		donec:   make(chan struct{}),
+		servedc: make(chan struct{}),
+	}
+
+	go func() {
+		defer close(l.servedc)
+		l.serveErr = l.serve()
+	}()
+	return l, nil
+}
+
+func (l *Listener) serve() error {
+	rc, err := l.f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	defer l.fail(nil)
+	defer wg.Wait()
+
+	for {
+		n, err := l.recv(rc)
+		switch {
+		case err == syscall.ENOENT, err == syscall.EINTR:
+			// the process was killed or interrupted before its notification
+			// was received.
+			continue
+		case err == errListenerHup:
+			return nil
+		case err != nil:
+			if closed, ferr := l.closed(); closed {
+				return ferr
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			resp := l.Handler.Notify(n)
+			if err := l.send(rc, n.ID, resp); err != nil && err != syscall.ENOENT {
+				l.fail(err)
+			}
+		}()
+	}
+}
+
+func (l *Listener) recv(rc syscall.RawConn) (*Notification, error) {
+	var (
+		notif seccompNotif
+		errno syscall.Errno
+		hup   bool
+	)
+
+	err := rc.Read(func(fd uintptr) bool {
+		// the runtime poller is edge triggered: pending notifications are
+		// checked before waiting for a new one.
+		fds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		if n, err := unix.Poll(fds, 0); err != nil || n == 0 {
+			return false
+		}
+		if fds[0].Revents&unix.POLLIN == 0 {
+			hup = fds[0].Revents&unix.POLLHUP != 0
+			return hup
+		}
+
+		// the kernel requires a zeroed struct seccomp_notif.
+		notif = seccompNotif{}
+		_, _, errno = syscall.Syscall(unix.SYS_IOCTL, fd, ioctlNotifRecv, uintptr(unsafe.Pointer(&notif)))
+		return true
+	})
+	switch {
+	case err != nil:
+		return nil, err
+	case hup:
+		return nil, errListenerHup
+	case errno != 0:
+		return nil, errno
+	}
+
+	return &Notification{
+		ID:  notif.id,
+		Pid: int(notif.pid),
+
+		NR:                 notif.data.nr,
+		Arch:               Arch(notif.data.arch),
+		InstructionPointer: notif.data.ip,
+		Args:               notif.data.args,
+
+		l: l,
+	}, nil
+}
+
+func (l *Listener) send(rc syscall.RawConn, id uint64, r Response) error {
+	resp := seccompNotifResp{
+		id:    id,
+		val:   r.Val,
+		error: -int32(r.Errno),
+	}
+	if r.Continue {
+		resp.val, resp.error, resp.flags = 0, 0, userNotifFlagContinue
+	}
+
+	var errno syscall.Errno
+	err := rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(unix.SYS_IOCTL, fd, ioctlNotifSend, uintptr(unsafe.Pointer(&resp)))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Valid reports whether the process of n is still waiting for a response.
+// Data read from the process memory must be checked with Valid, as the pid
+// may have been reused by another process.
+func (n *Notification) Valid() bool {
+	rc, err := n.l.f.SyscallConn()
+	if err != nil {
+		return false
+	}
+
+	var errno syscall.Errno
+	err = rc.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(unix.SYS_IOCTL, fd, ioctlNotifIDValid, uintptr(unsafe.Pointer(&n.ID)))
+	})
+	return err == nil && errno == 0
+}
+
+// ReadMem reads len(b) bytes of the process memory at addr, typically the
+// pointer argument of the syscall.
+func (n *Notification) ReadMem(addr uint64, b []byte) (int, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/mem", n.Pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if !n.Valid() {
+		return 0, ErrNotificationInvalid
+	}
+
+	cnt, err := f.ReadAt(b, int64(addr))
+	if err != nil {
+		return cnt, err
+	}
+
+	if !n.Valid() {
+		return 0, ErrNotificationInvalid
+	}
+	return cnt, nil
+}
+
+// ReadString reads a NUL terminated string of at most max bytes of the
+// process memory at addr.
+func (n *Notification) ReadString(addr uint64, max int) (string, error) {
+	var (
+		buf   []byte
+		start = addr
+	)
+	for len(buf) < max {
+		// reads do not cross page boundaries, the next page of a short
+		// string may be unmapped.
+		size := pageSize - int(addr%pageSize)
+		if rem := max - len(buf); size > rem {
+			size = rem
+		}
+
+		b := make([]byte, size)
+		if _, err := n.ReadMem(addr, b); err != nil {
+			return "", err
+		}
+
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			return string(append(buf, b[:i]...)), nil
+		}
+		buf = append(buf, b...)
+		addr += uint64(size)
+	}
+	return "", fmt.Errorf("seccomp: string at %#x exceeds %d bytes", start, max)
+}
@@ -0,0 +1,257 @@
+package seccomp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Action is a seccomp filter return action. The low 16 bits hold the action
+// data, e.g. the errno value of ActErrno.
+type Action uint32
+
+// Seccomp filter return actions. See include/uapi/linux/seccomp.h in Linux.
+const (
+	ActKillProcess Action = 0x80000000
+	ActKill        Action = 0x00000000
+	ActTrap        Action = 0x00030000
+	ActErrno       Action = 0x00050000
+	ActUserNotif   Action = 0x7fc00000
+	ActTrace       Action = 0x7ff00000
+	ActLog         Action = 0x7ffc0000
+	ActAllow       Action = 0x7fff0000
+
+	actionMask = 0xffff0000
+	dataMask   = 0x0000ffff
+)
+
+var actionNames = map[Action]string{
+	ActKillProcess: "kill_process",
+	ActKill:        "kill",
+	ActTrap:        "trap",
+	ActErrno:       "errno",
+	ActUserNotif:   "user_notif",
+	ActTrace:       "trace",
+	ActLog:         "log",
+	ActAllow:       "allow",
+}
+
+// WithData returns the action a with the action data set to data.
+func (a Action) WithData(data uint16) Action {
+	return a&actionMask | Action(data)
+}
+
+// Errno returns an ActErrno action returning errno to the caller.
+func Errno(errno syscall.Errno) Action {
+	return ActErrno.WithData(uint16(errno))
+}
+
+func (a Action) String() string {
+	name, ok := actionNames[a&actionMask]
+	if !ok {
+		return fmt.Sprintf("action(%#x)", uint32(a))
+	}
+
+	switch a & actionMask {
+	case ActErrno, ActTrace:
+		return name + "(" + strconv.Itoa(int(a&dataMask)) + ")"
+	default:
+		return name
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (a Action) MarshalText() ([]byte, error) {
+	if _, ok := actionNames[a&actionMask]; !ok {
+		return nil, fmt.Errorf("seccomp: unknown action %#x", uint32(a))
+	}
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. Actions are encoded as
+// e.g. "allow", "errno(1)" or "trace(0)".
+func (a *Action) UnmarshalText(text []byte) error {
+	name, data := string(text), ""
+	if i := strings.IndexByte(name, '('); i >= 0 && strings.HasSuffix(name, ")") {
+		name, data = name[:i], name[i+1:len(name)-1]
+	}
+
+	for act, actName := range actionNames {
+		if actName != name {
+			continue
+		}
+
+		if data == "" {
+			*a = act
+			return nil
+		}
+
+		n, err := strconv.ParseUint(data, 0, 16)
+		if err != nil {
+			return fmt.Errorf("seccomp: invalid action data %q", data)
+		}
+		*a = act.WithData(uint16(n))
+		return nil
+	}
+	return fmt.Errorf("seccomp: unknown action %q", string(text))
+}
+
+// Operator is a syscall argument comparison operator.
+type Operator int
+
+// Syscall argument comparison operators.
+const (
+	OpEqual Operator = iota + 1
+	OpNotEqual
+	OpLess
+	OpLessEqual
+	OpGreater
+	OpGreaterEqual
+	OpMaskedEqual
+)
+
+var operatorNames = map[Operator]string{
+	OpEqual:        "eq",
+	OpNotEqual:     "ne",
+	OpLess:         "lt",
+	OpLessEqual:    "le",
+	OpGreater:      "gt",
+	OpGreaterEqual: "ge",
+	OpMaskedEqual:  "masked_eq",
+}
+
+func (op Operator) String() string {
+	if name, ok := operatorNames[op]; ok {
+		return name
+	}
+	return "operator(" + strconv.Itoa(int(op)) + ")"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (op Operator) MarshalText() ([]byte, error) {
+	if _, ok := operatorNames[op]; !ok {
+		return nil, fmt.Errorf("seccomp: unknown operator %d", int(op))
+	}
+	return []byte(op.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (op *Operator) UnmarshalText(text []byte) error {
+	for o, name := range operatorNames {
+		if name == string(text) {
+			*op = o
+			return nil
+		}
+	}
+	return fmt.Errorf("seccomp: unknown operator %q", string(text))
+}
+
+// Profile is a seccomp filter policy. Syscall rules are matched in order, the
+// action of the first matching rule is taken. Syscalls not matched by any
+// rule take the default action.
+//
+// The profile is enforced for each of the Architectures, or the NativeArches
+// if unset. Processes calling syscalls of any other architecture are killed.
+type Profile struct {
+	DefaultAction Action `json:"default_action" toml:"default_action"`
+	Architectures []Arch `json:"architectures,omitempty" toml:"architectures,omitempty"`
+	Syscalls      []Rule `json:"syscalls,omitempty" toml:"syscalls,omitempty"`
+}
+
+// Rule matches the named syscalls when all argument conditions hold.
+type Rule struct {
+	Names  []string `json:"names" toml:"names"`
+	Action Action   `json:"action" toml:"action"`
+	Args   []Arg    `json:"args,omitempty" toml:"args,omitempty"`
+}
+
+// Arg is a condition on a syscall argument. For OpMaskedEqual, the argument
+// is masked by Mask before being compared to Value.
+type Arg struct {
+	Index uint     `json:"index" toml:"index"`
+	Op    Operator `json:"op" toml:"op"`
+	Value ArgValue `json:"value" toml:"value"`
+	Mask  ArgValue `json:"mask,omitempty" toml:"mask,omitempty"`
+}
+
+// ArgValue is a 64-bit syscall argument value. TOML integers are signed, so
+// values are encoded as hexadecimal strings in text formats; decimal strings
+// and integers are accepted too. JSON encodes values as numbers.
+type ArgValue uint64
+
+// MarshalText implements encoding.TextMarshaler.
+func (v ArgValue) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("%#x", uint64(v))), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (v *ArgValue) UnmarshalText(text []byte) error {
+	s, base := string(text), 10
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s, base = s[2:], 16
+	}
+	n, err := strconv.ParseUint(s, base, 64)
+	if err != nil {
+		return fmt.Errorf("seccomp: invalid argument value %q", string(text))
+	}
+	*v = ArgValue(n)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (v ArgValue) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatUint(uint64(v), 10)), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Numbers and strings are
+// accepted.
+func (v *ArgValue) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return v.UnmarshalText([]byte(s))
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	return v.UnmarshalText(data)
+}
+
+// DefaultProfile blocks the unshare syscall with EPERM and allows all other
+// syscalls. It is the profile of the program loaded by Load.
+var DefaultProfile = &Profile{
+	DefaultAction: ActAllow,
+	Syscalls: []Rule{
+		{
+			Names:  []string{"unshare"},
+			Action: Errno(syscall.EPERM),
+		},
+	},
+}
+
+var errTooManyArgs = errors.New("seccomp: syscall argument index out of range")
+
+// UsesUserNotif reports whether any action of p is ActUserNotif. The program
+// of such a profile must be loaded with a Listener.
+func (p *Profile) UsesUserNotif() bool {
+	if p.DefaultAction&actionMask == ActUserNotif {
+		return true
+	}
+	for _, rule := range p.Syscalls {
+		if rule.Action&actionMask == ActUserNotif {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks that p can be compiled.
+func (p *Profile) Validate() error {
+	_, err := Compile(p)
+	return err
+}
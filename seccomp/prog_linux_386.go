@@ -0,0 +1,29 @@
+// Code generated by github.com/heroku/dynolab/seccomp/_generate. DO NOT EDIT.
+
+package seccomp
+
+func init() {
+	prog = progData.SockFprog()
+}
+
+/*
+	0000: ld [4]
+	0001: jeq #0x40000003 jt 0002 jf 0006
+	0002: ld [0]
+	0003: jeq #0x136 jt 0005 jf 0004
+	0004: ret allow
+	0005: ret errno(1)
+	0006: ret kill
+*/
+
+// progData is the BPF program of DefaultProfile for the
+// i386 architecture.
+var progData = Program{
+	{Code: 0x20, Jt: 0, Jf: 0, K: 0x4},
+	{Code: 0x15, Jt: 0, Jf: 4, K: 0x40000003},
+	{Code: 0x20, Jt: 0, Jf: 0, K: 0x0},
+	{Code: 0x15, Jt: 1, Jf: 0, K: 0x136},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x7fff0000},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x50001},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x0},
+}
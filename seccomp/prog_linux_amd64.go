@@ -0,0 +1,41 @@
+// Code generated by github.com/heroku/dynolab/seccomp/_generate. DO NOT EDIT.
+
+package seccomp
+
+func init() {
+	prog = progData.SockFprog()
+}
+
+/*
+	0000: ld [4]
+	0001: jeq #0xc000003e jt 0002 jf 0007
+	0002: ld [0]
+	0003: jge #0x40000000 jt 0012 jf 0004
+	0004: jeq #0x110 jt 0006 jf 0005
+	0005: ret allow
+	0006: ret errno(1)
+	0007: jeq #0x40000003 jt 0008 jf 0012
+	0008: ld [0]
+	0009: jeq #0x136 jt 0011 jf 0010
+	0010: ret allow
+	0011: ret errno(1)
+	0012: ret kill
+*/
+
+// progData is the BPF program of DefaultProfile for the
+// x86_64, i386 architectures.
+var progData = Program{
+	{Code: 0x20, Jt: 0, Jf: 0, K: 0x4},
+	{Code: 0x15, Jt: 0, Jf: 5, K: 0xc000003e},
+	{Code: 0x20, Jt: 0, Jf: 0, K: 0x0},
+	{Code: 0x35, Jt: 8, Jf: 0, K: 0x40000000},
+	{Code: 0x15, Jt: 1, Jf: 0, K: 0x110},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x7fff0000},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x50001},
+	{Code: 0x15, Jt: 0, Jf: 4, K: 0x40000003},
+	{Code: 0x20, Jt: 0, Jf: 0, K: 0x0},
+	{Code: 0x15, Jt: 1, Jf: 0, K: 0x136},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x7fff0000},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x50001},
+	{Code: 0x6, Jt: 0, Jf: 0, K: 0x0},
+}
@@ -1,6 +1,8 @@
 package seccomp
 
-//go:generate go run github.com/heroku/dynolab/seccomp/_generate -o prog_linux.go
+//go:generate go run github.com/heroku/dynolab/seccomp/_generate -arch x86_64,i386 -o prog_linux_amd64.go
+//go:generate go run github.com/heroku/dynolab/seccomp/_generate -arch i386 -o prog_linux_386.go
+//go:generate go run github.com/heroku/dynolab/seccomp/_generate -arch aarch64 -o prog_linux_arm64.go
 
 import "errors"
 
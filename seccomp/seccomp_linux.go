@@ -7,22 +7,58 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-var (
-	// BlockedSyscalls are syscalls blocked from use by dyno applications.
-	BlockedSyscalls = []int32{
-		syscall.SYS_UNSHARE,
-	}
+var prog *syscall.SockFprog
 
-	prog *syscall.SockFprog
-)
+const (
+	seccompSetModeFilter = 0x1
 
-const seccompSetModeFilter = 0x1
+	seccompFilterFlagNewListener = 0x8
+)
 
 // Load sets the seccomp syscall-blocking program for the local system thread.
 func Load() error {
-	_, _, errno := syscall.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, 0, uintptr(unsafe.Pointer(prog)))
+	if prog == nil {
+		return ErrUnsupportedPlatform
+	}
+	_, err := load(prog, 0)
+	return err
+}
+
+// LoadProfile compiles and sets the seccomp program of p for the local system
+// thread.
+func LoadProfile(p *Profile) error {
+	prog, err := Compile(p)
+	if err != nil {
+		return err
+	}
+	return LoadProgram(prog)
+}
+
+// LoadProgram sets the seccomp program prog for the local system thread.
+func LoadProgram(prog Program) error {
+	_, err := load(prog.SockFprog(), 0)
+	return err
+}
+
+// SockFprog returns the program as a struct sock_fprog. The returned value
+// references the instructions of p.
+func (p Program) SockFprog() *syscall.SockFprog {
+	if len(p) == 0 {
+		return &syscall.SockFprog{}
+	}
+
+	return &syscall.SockFprog{
+		Len:    uint16(len(p)),
+		Filter: (*syscall.SockFilter)(unsafe.Pointer(&p[0])),
+	}
+}
+
+// load sets the seccomp program for the local system thread, and returns the
+// listener fd if the new listener flag is set.
+func load(prog *syscall.SockFprog, flags uintptr) (int, error) {
+	fd, _, errno := syscall.Syscall(unix.SYS_SECCOMP, seccompSetModeFilter, flags, uintptr(unsafe.Pointer(prog)))
 	if errno == syscall.Errno(0) {
-		return nil
+		return int(fd), nil
 	}
-	return errno
+	return -1, errno
 }
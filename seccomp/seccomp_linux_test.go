@@ -3,24 +3,179 @@
 package seccomp
 
 import (
+	"fmt"
+	"reflect"
 	"runtime"
 	"syscall"
 	"testing"
+	"time"
 )
 
+// runFiltered runs f on a dedicated system thread, after unsharing its mount
+// namespace. The thread exits with its goroutine once f returns, rather than
+// being handed back to the runtime with the filters loaded by f.
+func runFiltered(t *testing.T, f func() error) {
+	t.Helper()
+
+	skipc, errc := make(chan error, 1), make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		if err := syscall.Unshare(syscall.CLONE_NEWNS); err != nil {
+			skipc <- err
+			return
+		}
+		errc <- f()
+	}()
+
+	select {
+	case err := <-skipc:
+		t.Skip("invalid test permissions: " + err.Error())
+	case err := <-errc:
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestLoad(t *testing.T) {
-	runtime.LockOSThread()
-	defer runtime.UnlockOSThread()
+	runFiltered(t, func() error {
+		if err := Load(); err != nil {
+			return err
+		}
+
+		if want, got := syscall.EPERM, syscall.Unshare(syscall.CLONE_NEWNS); want != got {
+			return fmt.Errorf("want error %q, got %q", want, got)
+		}
+		return nil
+	})
+}
+
+func TestLoadProfile(t *testing.T) {
+	profile := &Profile{
+		DefaultAction: ActAllow,
+		Syscalls: []Rule{
+			{
+				Names:  []string{"unshare"},
+				Action: Errno(syscall.EACCES),
+				Args:   []Arg{{Index: 0, Op: OpMaskedEqual, Mask: syscall.CLONE_NEWNS, Value: syscall.CLONE_NEWNS}},
+			},
+		},
+	}
+
+	runFiltered(t, func() error {
+		if err := LoadProfile(profile); err != nil {
+			return err
+		}
+
+		if want, got := syscall.EACCES, syscall.Unshare(syscall.CLONE_NEWNS); want != got {
+			return fmt.Errorf("want error %q, got %q", want, got)
+		}
+		return nil
+	})
+}
+
+func TestLoadListener(t *testing.T) {
+	handler := func(n *Notification) Response {
+		switch n.Syscall() {
+		case "getppid":
+			return Return(42)
+		case "chdir":
+			path, err := n.ReadString(n.Args[0], 4096)
+			if err != nil {
+				return Deny(syscall.EFAULT)
+			}
+			if path == "/dynolab-denied" {
+				return Deny(syscall.EACCES)
+			}
+			return Deny(syscall.ENOENT)
+		default:
+			return Allow()
+		}
+	}
+
+	profile := &Profile{
+		DefaultAction: ActAllow,
+		Syscalls: []Rule{
+			{Names: []string{"getppid", "chdir"}, Action: ActUserNotif},
+		},
+	}
 
-	if err := syscall.Unshare(syscall.CLONE_NEWNS); err != nil {
+	prog, err := Compile(profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the filter is loaded on a dedicated system thread, which exits with
+	// the goroutine locked to it.
+	type result struct {
+		ppid  int
+		chdir error
+	}
+	listenerc, resc := make(chan *Listener, 1), make(chan result, 1)
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+
+		if err := syscall.Unshare(syscall.CLONE_NEWNS); err != nil {
+			errc <- err
+			return
+		}
+
+		l, err := LoadListener(prog, HandlerFunc(handler))
+		if err != nil {
+			errc <- err
+			return
+		}
+		listenerc <- l
+
+		// syscall.Getppid is a raw syscall, which would block the runtime
+		// until the listener responds.
+		ppid, _, _ := syscall.Syscall(syscall.SYS_GETPPID, 0, 0, 0)
+		resc <- result{
+			ppid:  int(ppid),
+			chdir: syscall.Chdir("/dynolab-denied"),
+		}
+	}()
+
+	var l *Listener
+	select {
+	case err := <-errc:
 		t.Skip("invalid test permissions: " + err.Error())
+	case l = <-listenerc:
 	}
 
-	if err := Load(); err != nil {
+	// the notifications are served as soon as the filter is loaded, before
+	// the listener is run.
+	var res result
+	select {
+	case res = <-resc:
+	case <-time.After(5 * time.Second):
+		t.Fatal("want notifications served before Run")
+	}
+	if want, got := 42, res.ppid; want != got {
+		t.Errorf("want ppid %d, got %d", want, got)
+	}
+	if want, got := syscall.EACCES, res.chdir; want != got {
+		t.Errorf("want error %q, got %q", want, got)
+	}
+
+	runc := make(chan error, 1)
+	go func() { runc <- l.Run() }()
+
+	l.Stop(nil)
+	if err := <-runc; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGeneratedProgram(t *testing.T) {
+	want, err := Compile(DefaultProfile)
+	if err != nil {
 		t.Fatal(err)
 	}
 
-	if want, got := syscall.EPERM, syscall.Unshare(syscall.CLONE_NEWNS); want != got {
-		t.Fatalf("want error %q, got %q", want, got)
+	if got := progData; !reflect.DeepEqual(want, got) {
+		t.Fatalf("generated program is out of date, want:\n%s\ngot:\n%s", want, got)
 	}
 }
@@ -4,3 +4,23 @@ package seccomp
 
 // Load is unsupported on this platform.
 func Load() error { return ErrUnsupportedPlatform }
+
+// LoadProfile is unsupported on this platform.
+func LoadProfile(p *Profile) error { return ErrUnsupportedPlatform }
+
+// LoadProgram is unsupported on this platform.
+func LoadProgram(prog Program) error { return ErrUnsupportedPlatform }
+
+// LoadListener is unsupported on this platform.
+func LoadListener(prog Program, h Handler) (*Listener, error) { return nil, ErrUnsupportedPlatform }
+
+// Valid is unsupported on this platform.
+func (n *Notification) Valid() bool { return false }
+
+// ReadMem is unsupported on this platform.
+func (n *Notification) ReadMem(addr uint64, b []byte) (int, error) { return 0, ErrUnsupportedPlatform }
+
+// ReadString is unsupported on this platform.
+func (n *Notification) ReadString(addr uint64, max int) (string, error) {
+	return "", ErrUnsupportedPlatform
+}
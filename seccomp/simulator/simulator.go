@@ -0,0 +1,317 @@
+// Package simulator interprets seccomp BPF programs against synthetic syscall
+// data, so that filters can be tested without being loaded into the kernel.
+// Like the kernel, the simulator rejects programs of invalid length, not ending
+// with a return, with misaligned or out of range data loads, constant
+// divisions by zero, constant shifts of 32 bits or more or jumps out of range;
+// other invalid loads and instructions are reported when they are executed.
+package simulator
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/heroku/dynolab/seccomp"
+)
+
+// Data is the syscall data inspected by a seccomp filter. It corresponds to
+// struct seccomp_data.
+type Data struct {
+	NR                 int32
+	Arch               seccomp.Arch
+	InstructionPointer uint64
+	Args               [6]uint64
+}
+
+// NewData returns the data of the named syscall on the architecture.
+func NewData(arch seccomp.Arch, name string, args ...uint64) (Data, error) {
+	nr, ok := arch.Syscall(name)
+	if !ok {
+		return Data{}, fmt.Errorf("simulator: unknown %s syscall %q", arch, name)
+	}
+	if len(args) > 6 {
+		return Data{}, errors.New("simulator: too many syscall arguments")
+	}
+
+	data := Data{
+		NR:   nr,
+		Arch: arch,
+	}
+	copy(data.Args[:], args)
+	return data, nil
+}
+
+const (
+	dataLen = 64
+
+	memWords = 16
+
+	maxInsns = 4096
+)
+
+// marshal encodes d in the host byte order of the architectures supported by
+// seccomp, which are all little endian.
+func (d Data) marshal() []byte {
+	buf := make([]byte, dataLen)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(d.NR))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(d.Arch))
+	binary.LittleEndian.PutUint64(buf[8:], d.InstructionPointer)
+	for i, arg := range d.Args {
+		binary.LittleEndian.PutUint64(buf[16+8*i:], arg)
+	}
+	return buf
+}
+
+// BPF instruction classes, sizes, modes, operations & sources. See
+// include/uapi/linux/filter.h in Linux.
+const (
+	classLD   = 0x00
+	classLDX  = 0x01
+	classST   = 0x02
+	classSTX  = 0x03
+	classALU  = 0x04
+	classJMP  = 0x05
+	classRET  = 0x06
+	classMISC = 0x07
+
+	sizeW = 0x00
+
+	modeIMM = 0x00
+	modeABS = 0x20
+	modeMEM = 0x60
+	modeLEN = 0x80
+
+	aluADD = 0x00
+	aluSUB = 0x10
+	aluMUL = 0x20
+	aluDIV = 0x30
+	aluOR  = 0x40
+	aluAND = 0x50
+	aluLSH = 0x60
+	aluRSH = 0x70
+	aluNEG = 0x80
+	aluMOD = 0x90
+	aluXOR = 0xa0
+
+	jmpJA   = 0x00
+	jmpJEQ  = 0x10
+	jmpJGT  = 0x20
+	jmpJGE  = 0x30
+	jmpJSET = 0x40
+
+	srcK = 0x00
+	srcX = 0x08
+
+	retA = 0x10
+
+	miscTAX = 0x00
+	miscTXA = 0x80
+)
+
+// Run interprets prog against data and returns the resulting action. An
+// error is returned for programs the kernel would reject or that fail at
+// runtime (e.g. out of range loads or jumps).
+func Run(prog seccomp.Program, data Data) (seccomp.Action, error) {
+	if err := check(prog); err != nil {
+		return 0, err
+	}
+
+	var (
+		buf  = data.marshal()
+		a, x uint32
+		mem  [memWords]uint32
+	)
+
+	for pc := 0; pc < len(prog); pc++ {
+		insn := prog[pc]
+
+		switch insn.Code & 0x07 {
+		case classLD:
+			switch insn.Code &^ 0x07 {
+			case sizeW | modeABS:
+				a = binary.LittleEndian.Uint32(buf[insn.K:])
+			case sizeW | modeIMM:
+				a = insn.K
+			case sizeW | modeLEN:
+				a = dataLen
+			case sizeW | modeMEM:
+				if insn.K >= memWords {
+					return 0, fmt.Errorf("simulator: invalid memory slot %d at %d", insn.K, pc)
+				}
+				a = mem[insn.K]
+			default:
+				return 0, invalidInstruction(insn, pc)
+			}
+		case classLDX:
+			switch insn.Code &^ 0x07 {
+			case sizeW | modeIMM:
+				x = insn.K
+			case sizeW | modeLEN:
+				x = dataLen
+			case sizeW | modeMEM:
+				if insn.K >= memWords {
+					return 0, fmt.Errorf("simulator: invalid memory slot %d at %d", insn.K, pc)
+				}
+				x = mem[insn.K]
+			default:
+				return 0, invalidInstruction(insn, pc)
+			}
+		case classST, classSTX:
+			if insn.Code&^0x07 != 0 {
+				return 0, invalidInstruction(insn, pc)
+			}
+			if insn.K >= memWords {
+				return 0, fmt.Errorf("simulator: invalid memory slot %d at %d", insn.K, pc)
+			}
+			if insn.Code&0x07 == classST {
+				mem[insn.K] = a
+			} else {
+				mem[insn.K] = x
+			}
+		case classALU:
+			operand := insn.K
+			if insn.Code&srcX != 0 {
+				operand = x
+			}
+
+			switch insn.Code & 0xf0 {
+			case aluADD:
+				a += operand
+			case aluSUB:
+				a -= operand
+			case aluMUL:
+				a *= operand
+			case aluDIV:
+				if operand == 0 {
+					return 0, nil
+				}
+				a /= operand
+			case aluMOD:
+				if operand == 0 {
+					return 0, nil
+				}
+				a %= operand
+			case aluOR:
+				a |= operand
+			case aluAND:
+				a &= operand
+			case aluXOR:
+				a ^= operand
+			case aluLSH:
+				a <<= operand
+			case aluRSH:
+				a >>= operand
+			case aluNEG:
+				a = -a
+			default:
+				return 0, invalidInstruction(insn, pc)
+			}
+		case classJMP:
+			operand := insn.K
+			if insn.Code&srcX != 0 {
+				operand = x
+			}
+
+			var cond bool
+			switch insn.Code & 0xf0 {
+			case jmpJA:
+				if pc+int(insn.K)+1 >= len(prog) {
+					return 0, fmt.Errorf("simulator: jump out of range at %d", pc)
+				}
+				pc += int(insn.K)
+				continue
+			case jmpJEQ:
+				cond = a == operand
+			case jmpJGT:
+				cond = a > operand
+			case jmpJGE:
+				cond = a >= operand
+			case jmpJSET:
+				cond = a&operand != 0
+			default:
+				return 0, invalidInstruction(insn, pc)
+			}
+
+			off := int(insn.Jf)
+			if cond {
+				off = int(insn.Jt)
+			}
+			if pc+off+1 >= len(prog) {
+				return 0, fmt.Errorf("simulator: jump out of range at %d", pc)
+			}
+			pc += off
+		case classRET:
+			switch insn.Code &^ 0x07 {
+			case srcK:
+				return seccomp.Action(insn.K), nil
+			case retA:
+				return seccomp.Action(a), nil
+			default:
+				return 0, invalidInstruction(insn, pc)
+			}
+		case classMISC:
+			switch insn.Code &^ 0x07 {
+			case miscTAX:
+				x = a
+			case miscTXA:
+				a = x
+			default:
+				return 0, invalidInstruction(insn, pc)
+			}
+		}
+	}
+
+	return 0, errors.New("simulator: program ended without return")
+}
+
+// check returns an error for the programs the kernel rejects when loading the
+// filter: programs of invalid length, divisions by a zero constant, shifts by
+// constants of 32 or more and jumps past the end of the program. See
+// bpf_check_classic in net/core/filter.c in Linux.
+func check(prog seccomp.Program) error {
+	if len(prog) == 0 || len(prog) > maxInsns {
+		return fmt.Errorf("simulator: invalid program length %d", len(prog))
+	}
+	if prog[len(prog)-1].Code&0x07 != classRET {
+		return errors.New("simulator: program does not end with a return")
+	}
+
+	for pc, insn := range prog {
+		switch insn.Code & 0x07 {
+		case classLD:
+			if insn.Code == classLD|sizeW|modeABS && (insn.K%4 != 0 || insn.K > dataLen-4) {
+				return fmt.Errorf("simulator: invalid load offset %d at %d", insn.K, pc)
+			}
+		case classALU:
+			if insn.Code&srcX != 0 {
+				continue
+			}
+
+			switch insn.Code & 0xf0 {
+			case aluDIV, aluMOD:
+				if insn.K == 0 {
+					return fmt.Errorf("simulator: division by zero at %d", pc)
+				}
+			case aluLSH, aluRSH:
+				if insn.K >= 32 {
+					return fmt.Errorf("simulator: invalid shift %d at %d", insn.K, pc)
+				}
+			}
+		case classJMP:
+			if insn.Code&0xf0 == jmpJA {
+				if uint64(pc)+uint64(insn.K)+1 >= uint64(len(prog)) {
+					return fmt.Errorf("simulator: jump out of range at %d", pc)
+				}
+				continue
+			}
+			if pc+int(insn.Jt)+1 >= len(prog) || pc+int(insn.Jf)+1 >= len(prog) {
+				return fmt.Errorf("simulator: jump out of range at %d", pc)
+			}
+		}
+	}
+	return nil
+}
+
+func invalidInstruction(insn seccomp.Instruction, pc int) error {
+	return fmt.Errorf("simulator: invalid instruction %#x at %d", insn.Code, pc)
+}
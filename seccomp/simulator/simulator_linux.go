@@ -0,0 +1,23 @@
+package simulator
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/heroku/dynolab/seccomp"
+)
+
+// RunSockFprog interprets the program of a struct sock_fprog against data.
+func RunSockFprog(fprog *syscall.SockFprog, data Data) (seccomp.Action, error) {
+	if fprog.Len == 0 {
+		return Run(nil, data)
+	}
+
+	filters := (*[1 << 16]syscall.SockFilter)(unsafe.Pointer(fprog.Filter))[:fprog.Len:fprog.Len]
+
+	prog := make(seccomp.Program, len(filters))
+	for i, f := range filters {
+		prog[i] = seccomp.Instruction{Code: f.Code, Jt: f.Jt, Jf: f.Jf, K: f.K}
+	}
+	return Run(prog, data)
+}
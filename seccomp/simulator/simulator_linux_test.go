@@ -0,0 +1,30 @@
+package simulator
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/heroku/dynolab/seccomp"
+)
+
+func TestRunSockFprog(t *testing.T) {
+	prog, err := seccomp.Compile(seccomp.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, arch := range seccomp.NativeArches() {
+		data, err := NewData(arch, "unshare")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := RunSockFprog(prog.SockFprog(), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := seccomp.Errno(syscall.EPERM); want != got {
+			t.Errorf("%s: want action %s, got %s", arch, want, got)
+		}
+	}
+}
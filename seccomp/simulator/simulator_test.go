@@ -0,0 +1,193 @@
+package simulator
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/heroku/dynolab/seccomp"
+)
+
+func TestRunDefaultProfile(t *testing.T) {
+	arches := []seccomp.Arch{seccomp.ArchX86_64, seccomp.ArchI386, seccomp.ArchAARCH64}
+
+	for _, arch := range arches {
+		profile := *seccomp.DefaultProfile
+		profile.Architectures = []seccomp.Arch{arch}
+
+		prog, err := seccomp.Compile(&profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name string
+			args []uint64
+			want seccomp.Action
+		}{
+			{"unshare", []uint64{0x40000000 /* CLONE_NEWNET */}, seccomp.Errno(syscall.EPERM)},
+			{"read", []uint64{0, 0, 4096}, seccomp.ActAllow},
+			{"setns", nil, seccomp.ActAllow},
+		}
+
+		for _, test := range tests {
+			data, err := NewData(arch, test.name, test.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Run(prog, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := test.want; want != got {
+				t.Errorf("%s %s: want action %s, got %s", arch, test.name, want, got)
+			}
+
+			for _, other := range arches {
+				if other == arch {
+					continue
+				}
+
+				data.Arch = other
+				if got, err := Run(prog, data); err != nil {
+					t.Fatal(err)
+				} else if want := seccomp.ActKill; want != got {
+					t.Errorf("%s %s on %s: want action %s, got %s", arch, test.name, other, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	const (
+		ldW   = classLD | sizeW
+		ldxW  = classLDX | sizeW
+		jmpK  = classJMP | srcK
+		aluK  = classALU | srcK
+		aluX  = classALU | srcX
+		retK  = classRET | srcK
+		retAc = classRET | retA
+	)
+
+	data := Data{
+		NR:                 42,
+		Arch:               seccomp.ArchX86_64,
+		InstructionPointer: 0x7fff00001000,
+		Args:               [6]uint64{0x100000002},
+	}
+
+	tests := []struct {
+		name string
+		prog seccomp.Program
+		want seccomp.Action
+	}{
+		{
+			name: "nr",
+			prog: seccomp.Program{
+				{Code: ldW | modeABS, K: 0},
+				{Code: retAc},
+			},
+			want: 42,
+		},
+		{
+			name: "instruction pointer",
+			prog: seccomp.Program{
+				{Code: ldW | modeABS, K: 12},
+				{Code: retAc},
+			},
+			want: 0x7fff,
+		},
+		{
+			name: "arg high word",
+			prog: seccomp.Program{
+				{Code: ldW | modeABS, K: 20},
+				{Code: jmpK | jmpJEQ, Jt: 0, Jf: 1, K: 1},
+				{Code: retK, K: uint32(seccomp.ActAllow)},
+				{Code: retK, K: uint32(seccomp.ActKill)},
+			},
+			want: seccomp.ActAllow,
+		},
+		{
+			name: "jump always",
+			prog: seccomp.Program{
+				{Code: jmpK | jmpJA, K: 1},
+				{Code: retK, K: uint32(seccomp.ActKill)},
+				{Code: retK, K: uint32(seccomp.ActLog)},
+			},
+			want: seccomp.ActLog,
+		},
+		{
+			name: "alu",
+			prog: seccomp.Program{
+				{Code: ldW | modeIMM, K: 6},
+				{Code: ldxW | modeIMM, K: 3},
+				{Code: aluX | aluMUL},
+				{Code: aluK | aluSUB, K: 2},
+				{Code: aluK | aluRSH, K: 1},
+				{Code: retAc},
+			},
+			want: 8,
+		},
+		{
+			name: "memory",
+			prog: seccomp.Program{
+				{Code: ldW | modeLEN},
+				{Code: classST, K: 3},
+				{Code: ldW | modeIMM, K: 0},
+				{Code: ldxW | modeMEM, K: 3},
+				{Code: classMISC | miscTXA},
+				{Code: retAc},
+			},
+			want: 64,
+		},
+		{
+			name: "division by zero",
+			prog: seccomp.Program{
+				{Code: ldW | modeIMM, K: 1},
+				{Code: aluX | aluDIV},
+				{Code: retK, K: uint32(seccomp.ActAllow)},
+			},
+			want: seccomp.ActKill,
+		},
+	}
+
+	for _, test := range tests {
+		got, err := Run(test.prog, data)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if want := test.want; want != got {
+			t.Errorf("%s: want action %#x, got %#x", test.name, uint32(want), uint32(got))
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		prog seccomp.Program
+	}{
+		{"empty", nil},
+		{"no return", seccomp.Program{{Code: classLD | sizeW | modeIMM}}},
+		{"return not last", seccomp.Program{{Code: classRET}, {Code: classLD | sizeW | modeIMM}}},
+		{"unaligned load", seccomp.Program{{Code: classLD | sizeW | modeABS, K: 2}, {Code: classRET}}},
+		{"load out of range", seccomp.Program{{Code: classLD | sizeW | modeABS, K: 64}, {Code: classRET}}},
+		{"unreachable invalid load", seccomp.Program{{Code: classRET}, {Code: classLD | sizeW | modeABS, K: 2}, {Code: classRET}}},
+		{"load offset overflow", seccomp.Program{{Code: classLD | sizeW | modeABS, K: 0xfffffffc}, {Code: classRET}}},
+		{"too long", make(seccomp.Program, maxInsns+1)},
+		{"division by zero", seccomp.Program{{Code: classALU | aluDIV | srcK}, {Code: classRET}}},
+		{"modulo by zero", seccomp.Program{{Code: classALU | aluMOD | srcK}, {Code: classRET}}},
+		{"shift out of range", seccomp.Program{{Code: classALU | aluLSH | srcK, K: 32}, {Code: classRET}}},
+		{"conditional jump out of range", seccomp.Program{{Code: classJMP | jmpJEQ, Jf: 1}, {Code: classRET}}},
+		{"jump out of range", seccomp.Program{{Code: classJMP | jmpJA, K: 1}}},
+		{"invalid instruction", seccomp.Program{{Code: 0xff}}},
+	}
+
+	for _, test := range tests {
+		if _, err := Run(test.prog, Data{}); err == nil {
+			t.Errorf("%s: want error", test.name)
+		}
+	}
+}
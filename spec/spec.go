@@ -0,0 +1,467 @@
+// Package spec implements a declarative file format for dyno container
+// configurations.
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/heroku/dynolab/exec"
+	"github.com/heroku/dynolab/networking"
+	"github.com/heroku/dynolab/seccomp"
+)
+
+// Version is the current version of the spec format.
+const Version = 1
+
+// maxInterfaceLen is the length of the longest network interface name, see
+// IFNAMSIZ in Linux.
+const maxInterfaceLen = 15
+
+// Format is a spec file encoding.
+type Format string
+
+// Supported spec file encodings.
+const (
+	JSON Format = "json"
+	TOML Format = "toml"
+)
+
+// Spec is the complete configuration of a dyno container.
+type Spec struct {
+	Version int `json:"version" toml:"version"`
+
+	Dyno    Dyno     `json:"dyno" toml:"dyno"`
+	Network *Network `json:"network,omitempty" toml:"network,omitempty"`
+}
+
+// Dyno is the dyno process group configuration. It corresponds to the fields
+// of exec.Dyno.
+type Dyno struct {
+	CommandLine []string `json:"command_line" toml:"command_line"`
+
+	Dir string   `json:"dir,omitempty" toml:"dir,omitempty"`
+	Env []string `json:"env,omitempty" toml:"env,omitempty"`
+
+	ShutdownPeriod Duration `json:"shutdown_period,omitempty" toml:"shutdown_period,omitempty"`
+
+	UID          int      `json:"uid,omitempty" toml:"uid,omitempty"`
+	GID          int      `json:"gid,omitempty" toml:"gid,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty" toml:"capabilities,omitempty"`
+	LoadSeccomp  bool     `json:"load_seccomp,omitempty" toml:"load_seccomp,omitempty"`
+
+	// SeccompProfile replaces the default seccomp profile of LoadSeccomp.
+	SeccompProfile *seccomp.Profile `json:"seccomp_profile,omitempty" toml:"seccomp_profile,omitempty"`
+
+	CapabilitySets *CapabilitySets `json:"capability_sets,omitempty" toml:"capability_sets,omitempty"`
+
+	AddProcHidepidFlag bool `json:"add_proc_hidepid_flag,omitempty" toml:"add_proc_hidepid_flag,omitempty"`
+}
+
+// CapabilitySets configures each capability set of the dyno process. It
+// corresponds to the fields of exec.CapabilitySets: a missing or null set
+// leaves the set unchanged, while an empty set clears it.
+type CapabilitySets struct {
+	Effective   []string `json:"effective" toml:"effective"`
+	Permitted   []string `json:"permitted" toml:"permitted"`
+	Inheritable []string `json:"inheritable" toml:"inheritable"`
+	Ambient     []string `json:"ambient" toml:"ambient"`
+	Bounding    []string `json:"bounding" toml:"bounding"`
+
+	NoNewPrivs bool `json:"no_new_privs,omitempty" toml:"no_new_privs,omitempty"`
+}
+
+// Network is the dyno network configuration. It corresponds to the fields of
+// networking.Network.
+type Network struct {
+	Subnet  string `json:"subnet" toml:"subnet"`
+	Gateway string `json:"gateway" toml:"gateway"`
+
+	// IP and Interface are the address and name of the TUN interface of
+	// the dyno. The environment configuration is used if unset.
+	IP        string `json:"ip,omitempty" toml:"ip,omitempty"`
+	Interface string `json:"interface,omitempty" toml:"interface,omitempty"`
+
+	MTU int `json:"mtu,omitempty" toml:"mtu,omitempty"`
+
+	TxQueueLen  int `json:"tx_queue_len,omitempty" toml:"tx_queue_len,omitempty"`
+	RxWindowLen int `json:"rx_window_len,omitempty" toml:"rx_window_len,omitempty"`
+
+	MaxEgressConnCount int `json:"max_egress_conn_count,omitempty" toml:"max_egress_conn_count,omitempty"`
+}
+
+// Duration is a time.Duration encoded as a string, e.g. "30s".
+type Duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *Duration) UnmarshalText(text []byte) error {
+	dur, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(dur)
+	return nil
+}
+
+// Load reads and validates the spec file at path. The format is determined
+// by the file extension.
+func Load(path string) (*Spec, error) {
+	format, err := formatOf(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, format)
+}
+
+// Save writes s to the spec file at path. The format is determined by the
+// file extension. The file is only readable by its owner, since the
+// environment of the dyno may hold secrets.
+func (s *Spec) Save(path string) error {
+	format, err := formatOf(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := s.Marshal(format)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func formatOf(path string) (Format, error) {
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		return JSON, nil
+	case ".toml":
+		return TOML, nil
+	default:
+		return "", fmt.Errorf("spec: unknown file extension %q", ext)
+	}
+}
+
+// Parse decodes and validates a spec.
+func Parse(data []byte, format Format) (*Spec, error) {
+	s := new(Spec)
+	switch format {
+	case JSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(s); err != nil {
+			return nil, err
+		}
+	case TOML:
+		md, err := toml.Decode(string(data), s)
+		if err != nil {
+			return nil, err
+		}
+		if keys := md.Undecoded(); len(keys) > 0 {
+			return nil, fmt.Errorf("spec: unknown field %q", keys[0].String())
+		}
+	default:
+		return nil, fmt.Errorf("spec: unknown format %q", format)
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Marshal encodes s in the format.
+func (s *Spec) Marshal(format Format) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case JSON:
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(s); err != nil {
+			return nil, err
+		}
+	case TOML:
+		if err := toml.NewEncoder(&buf).Encode(s); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("spec: unknown format %q", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidationError lists every problem found in a spec.
+type ValidationError []error
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return "spec: " + strings.Join(msgs, "; ")
+}
+
+// Validate checks that s describes a runnable dyno. All problems are reported
+// at once in a ValidationError.
+func (s *Spec) Validate() error {
+	var errs ValidationError
+	fail := func(format string, a ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, a...))
+	}
+
+	switch {
+	case s.Version == 0:
+		fail("version: missing")
+	case s.Version != Version:
+		fail("version: unsupported version %d", s.Version)
+	}
+
+	d := s.Dyno
+	if len(d.CommandLine) == 0 || d.CommandLine[0] == "" {
+		fail("dyno.command_line: missing")
+	}
+	for _, envVar := range d.Env {
+		if !strings.Contains(envVar, "=") || strings.HasPrefix(envVar, "=") {
+			fail("dyno.env: invalid variable %q", envVar)
+		}
+	}
+	if d.ShutdownPeriod < 0 {
+		fail("dyno.shutdown_period: negative duration %s", time.Duration(d.ShutdownPeriod))
+	}
+	if d.UID < 0 {
+		fail("dyno.uid: invalid uid %d", d.UID)
+	}
+	if d.GID < 0 {
+		fail("dyno.gid: invalid gid %d", d.GID)
+	}
+	for _, name := range d.Capabilities {
+		if !exec.IsCapability(name) {
+			fail("dyno.capabilities: unknown capability %q", name)
+		}
+	}
+	if d.SeccompProfile != nil {
+		if d.LoadSeccomp {
+			fail("dyno.seccomp_profile: conflicts with dyno.load_seccomp")
+		}
+		if err := d.SeccompProfile.Validate(); err != nil {
+			fail("dyno.seccomp_profile: %s", strings.TrimPrefix(err.Error(), "seccomp: "))
+		}
+	}
+	if cs := d.CapabilitySets; cs != nil {
+		if d.Capabilities != nil {
+			fail("dyno.capability_sets: conflicts with dyno.capabilities")
+		}
+
+		sets := []struct {
+			name  string
+			names []string
+		}{
+			{"effective", cs.Effective},
+			{"permitted", cs.Permitted},
+			{"inheritable", cs.Inheritable},
+			{"ambient", cs.Ambient},
+			{"bounding", cs.Bounding},
+		}
+		for _, set := range sets {
+			for _, name := range set.names {
+				if !exec.IsCapability(name) {
+					fail("dyno.capability_sets.%s: unknown capability %q", set.name, name)
+				}
+			}
+		}
+	}
+
+	if n := s.Network; n != nil {
+		_, subnet, err := net.ParseCIDR(n.Subnet)
+		if err != nil || subnet.IP.To4() == nil {
+			fail("network.subnet: invalid IPv4 subnet %q", n.Subnet)
+			subnet = nil
+		}
+
+		gateway := net.ParseIP(n.Gateway).To4()
+		if gateway == nil {
+			fail("network.gateway: invalid IPv4 address %q", n.Gateway)
+		}
+		if subnet != nil && gateway != nil && !subnet.Contains(gateway) {
+			fail("network.gateway: %s is not part of subnet %s", gateway, subnet)
+		}
+
+		if n.IP != "" {
+			ip := net.ParseIP(n.IP).To4()
+			switch {
+			case ip == nil:
+				fail("network.ip: invalid IPv4 address %q", n.IP)
+			case subnet != nil && !subnet.Contains(ip):
+				fail("network.ip: %s is not part of subnet %s", ip, subnet)
+			}
+		}
+		if len(n.Interface) > maxInterfaceLen || strings.ContainsAny(n.Interface, "/ \t\n") {
+			fail("network.interface: invalid name %q", n.Interface)
+		}
+
+		if n.MTU < 0 || int(uint32(n.MTU)) != n.MTU {
+			fail("network.mtu: invalid MTU %d", n.MTU)
+		}
+		if n.TxQueueLen < 0 {
+			fail("network.tx_queue_len: invalid length %d", n.TxQueueLen)
+		}
+		if n.RxWindowLen < 0 {
+			fail("network.rx_window_len: invalid length %d", n.RxWindowLen)
+		}
+		if n.MaxEgressConnCount < 0 {
+			fail("network.max_egress_conn_count: invalid count %d", n.MaxEgressConnCount)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Build validates s and returns the corresponding dyno and network. The
+// network is nil if s has no network configuration.
+func (s *Spec) Build() (*exec.Dyno, *networking.Network, error) {
+	if err := s.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	d := s.Dyno
+	dyno := &exec.Dyno{
+		CommandLine: d.CommandLine,
+
+		Dir: d.Dir,
+		Env: d.Env,
+
+		ShutdownPeriod: time.Duration(d.ShutdownPeriod),
+
+		UID:          d.UID,
+		GID:          d.GID,
+		Capabilities: d.Capabilities,
+
+		AddProcHidepidFlag: d.AddProcHidepidFlag,
+	}
+	switch {
+	case d.SeccompProfile != nil:
+		dyno.LoadSeccomp = d.SeccompProfile
+	case d.LoadSeccomp:
+		dyno.LoadSeccomp = seccomp.DefaultProfile
+	}
+	if cs := d.CapabilitySets; cs != nil {
+		dyno.CapabilitySets = &exec.CapabilitySets{
+			Effective:   cs.Effective,
+			Permitted:   cs.Permitted,
+			Inheritable: cs.Inheritable,
+			Ambient:     cs.Ambient,
+			Bounding:    cs.Bounding,
+			NoNewPrivs:  cs.NoNewPrivs,
+		}
+	}
+
+	n := s.Network
+	if n == nil {
+		return dyno, nil, nil
+	}
+
+	_, subnet, err := net.ParseCIDR(n.Subnet)
+	if err != nil {
+		panic("impossible")
+	}
+
+	network := &networking.Network{
+		Subnet:  subnet,
+		Gateway: net.ParseIP(n.Gateway).To4(),
+
+		MTU: n.MTU,
+
+		TxQueueLen:  n.TxQueueLen,
+		RxWindowLen: n.RxWindowLen,
+
+		MaxEgressConnCount: n.MaxEgressConnCount,
+	}
+	return dyno, network, nil
+}
+
+// FromDyno returns the spec for a dyno and its (optional) network, such that
+// building the returned spec produces an equivalent configuration.
+func FromDyno(dyno *exec.Dyno, network *networking.Network) (*Spec, error) {
+	if dyno == nil {
+		return nil, errors.New("spec: missing dyno")
+	}
+
+	s := &Spec{
+		Version: Version,
+		Dyno: Dyno{
+			CommandLine: dyno.CommandLine,
+
+			Dir: dyno.Dir,
+			Env: dyno.Env,
+
+			ShutdownPeriod: Duration(dyno.ShutdownPeriod),
+
+			UID:          dyno.UID,
+			GID:          dyno.GID,
+			Capabilities: dyno.Capabilities,
+
+			AddProcHidepidFlag: dyno.AddProcHidepidFlag,
+		},
+	}
+	switch {
+	case dyno.LoadSeccomp == nil:
+	case reflect.DeepEqual(dyno.LoadSeccomp, seccomp.DefaultProfile):
+		s.Dyno.LoadSeccomp = true
+	default:
+		s.Dyno.SeccompProfile = dyno.LoadSeccomp
+	}
+	if cs := dyno.CapabilitySets; cs != nil {
+		s.Dyno.CapabilitySets = &CapabilitySets{
+			Effective:   cs.Effective,
+			Permitted:   cs.Permitted,
+			Inheritable: cs.Inheritable,
+			Ambient:     cs.Ambient,
+			Bounding:    cs.Bounding,
+			NoNewPrivs:  cs.NoNewPrivs,
+		}
+	}
+
+	if network != nil {
+		if network.Subnet == nil {
+			return nil, errors.New("spec: missing network subnet")
+		}
+
+		s.Network = &Network{
+			Subnet:  network.Subnet.String(),
+			Gateway: network.Gateway.String(),
+
+			MTU: network.MTU,
+
+			TxQueueLen:  network.TxQueueLen,
+			RxWindowLen: network.RxWindowLen,
+
+			MaxEgressConnCount: network.MaxEgressConnCount,
+		}
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
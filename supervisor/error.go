@@ -0,0 +1,106 @@
+package supervisor
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Exit is the last exit of an actor.
+type Exit struct {
+	Name string
+	Err  error
+	Time time.Time
+
+	// Trigger is set on the exit which interrupted the group.
+	Trigger bool
+}
+
+// RunError is returned by a group interrupted by an actor error. It carries
+// the exits of all actors, in start order. errors.Is and errors.As match the
+// triggering error first, then the errors of the other actors.
+type RunError struct {
+	Exits []Exit
+}
+
+func (e *RunError) Error() string {
+	var trigger string
+	var others []string
+	for _, exit := range e.Exits {
+		switch {
+		case exit.Trigger:
+			trigger = fmt.Sprintf("%s: %v", exit.Name, exit.Err)
+		case exit.Err != nil:
+			others = append(others, fmt.Sprintf("%s: %v", exit.Name, exit.Err))
+		}
+	}
+
+	msg := "supervisor: " + trigger
+	if len(others) > 0 {
+		msg += " (also " + strings.Join(others, "; ") + ")"
+	}
+	return msg
+}
+
+// Trigger returns the error which interrupted the group.
+func (e *RunError) Trigger() error {
+	for _, exit := range e.Exits {
+		if exit.Trigger {
+			return exit.Err
+		}
+	}
+	return nil
+}
+
+// Errors returns the non-nil actor errors, starting with the trigger.
+func (e *RunError) Errors() []error {
+	var errs []error
+	if err := e.Trigger(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, exit := range e.Exits {
+		if exit.Err != nil && !exit.Trigger {
+			errs = append(errs, exit.Err)
+		}
+	}
+	return errs
+}
+
+// Is reports whether any actor error matches target.
+func (e *RunError) Is(target error) bool {
+	for _, err := range e.Errors() {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first actor error matching target.
+func (e *RunError) As(target interface{}) bool {
+	for _, err := range e.Errors() {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ShutdownError is returned by a group whose actors have not exited within
+// their shutdown timeout once interrupted by Err.
+type ShutdownError struct {
+	Err    error
+	Actors []ActorStatus
+}
+
+func (e *ShutdownError) Error() string {
+	actors := make([]string, 0, len(e.Actors))
+	for _, a := range e.Actors {
+		actors = append(actors, fmt.Sprintf("%s (%s)", a.Name, a.State))
+	}
+	return "supervisor: actors failed to stop: " + strings.Join(actors, ", ")
+}
+
+// Unwrap returns the error interrupting the group.
+func (e *ShutdownError) Unwrap() error { return e.Err }
@@ -1,5 +1,11 @@
 package supervisor
 
+import (
+	"context"
+	"sync"
+	"time"
+)
+
 // Group manages the lifecycle of services and tasks. A task is a service that
 // a nil error. It is identical to a github.com/oklog/run.Group except in the
 // following ways:
@@ -10,10 +16,27 @@ package supervisor
 // * Start will return a non-nil error if an existing execute func has already returned a non-nil error.
 // * execute funcs are interupted in the reverse order they are started.
 // * if Start returns a non-nil error, all other executors have already been interupted.
+//
+// A Group is itself an actor, started in another group with its Run and Stop
+// methods, to form a supervision tree. Run may be called again once it has
+// returned, restarting all actors of the group as a unit.
 type Group struct {
-	actors []actor
+	// Strategy determines which actors are restarted along with a restarted
+	// actor. The zero value is OneForOne.
+	Strategy Strategy
 
 	errc chan error
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	actors      []*actor
+	ran         bool
+	stopping    bool
+	restarting  bool
+	triggered   bool
+	stoppedc    chan struct{}
+	shutdownErr *ShutdownError
+	notify      []chan<- Event
 }
 
 // Start runs an actor by launching the execute func registering it with the
@@ -22,29 +45,70 @@ type Group struct {
 // interrupt even after execute has returned.
 //
 // The first actor (function) to return a non-nil error interrupts all running
-// actors. The error is passed to the interrupt functions, and is returned by
-// Run.
+// actors. The error is passed to the interrupt functions, and Run returns it
+// wrapped in a *RunError; use errors.Is or errors.As to match it.
 //
-// If an actor added to the group has already triggered interrupts, the
-// triggering error is returned by Start.
+// If an actor added to the group has already triggered interrupts, Start
+// returns the *RunError wrapping the triggering error.
 func (g *Group) Start(execute func() error, interrupt func(error)) error {
-	if g.errc == nil {
-		g.errc = make(chan error, 1)
-	}
+	return g.StartActor(Actor{
+		Execute:   execute,
+		Interrupt: interrupt,
+	})
+}
+
+// StartContext runs an actor like Start, interrupted by cancelling the
+// context passed to execute.
+func (g *Group) StartContext(execute func(ctx context.Context) error) error {
+	return g.StartActor(Actor{
+		ExecuteContext: execute,
+	})
+}
+
+// Actor is the configuration of an actor started with StartActor.
+type Actor struct {
+	// Name identifies the actor in errors. Unnamed actors are named after
+	// their start index.
+	Name string
+
+	// Execute and Interrupt follow the contract of Start. Restarted actors
+	// must also handle Interrupt being called before Execute runs again.
+	Execute   func() error
+	Interrupt func(error)
+
+	// ExecuteContext replaces Execute and Interrupt: each execution is
+	// passed a new context, cancelled to interrupt it.
+	ExecuteContext func(ctx context.Context) error
+
+	// ShutdownTimeout is how long the group waits for the actor to exit once
+	// interrupted, before interrupting the next actor. A zero timeout waits
+	// until it exits.
+	ShutdownTimeout time.Duration
+
+	// Restart is the restart policy of the actor. The returned errors of a
+	// restarted actor only interrupt the group once its restart budget is
+	// exhausted.
+	Restart Restart
+
+	// Probe is the liveness probe of the actor, if Probe.Check is set.
+	Probe Probe
+}
+
+// StartActor runs an actor like Start, with the configuration of a.
+func (g *Group) StartActor(a Actor) error {
+	g.init()
 
 	select {
 	case err := <-g.errc:
-		g.interrupt(err)
-		return err
+		return g.shutdown(err)
 	default:
 	}
 
-	act := actor{
-		interrupt: interrupt,
-		donec:     make(chan struct{}),
-	}
-	go act.run(execute, g.errc)
+	g.mu.Lock()
+	act := &actor{Actor: a, index: len(g.actors)}
 	g.actors = append(g.actors, act)
+	g.launch(act)
+	g.mu.Unlock()
 
 	return nil
 }
@@ -52,45 +116,401 @@ func (g *Group) Start(execute func() error, interrupt func(error)) error {
 // Run all actors (functions) concurrently.
 // When an actor returns a non-nil error, all others are interrupted.
 // Run only returns when all actors have exited.
-// Run returns the error returned by the first exiting actor.
+// Run returns a *RunError with the exits of all actors, triggered by the first
+// actor error.
+//
+// If actors have not exited within their shutdown timeout, Run returns
+// without waiting for them, with a *ShutdownError.
+//
+// Calling Run again after it has returned launches all actors again.
 func (g *Group) Run() error {
-	for _, a := range g.actors {
+	g.init()
+
+	g.mu.Lock()
+	if g.ran {
+		g.relaunch()
+	}
+	g.ran = true
+	actors := append([]*actor(nil), g.actors...)
+	stoppedc := g.stoppedc
+	g.mu.Unlock()
+
+	for _, a := range actors {
 		select {
 		case err := <-g.errc:
-			g.interrupt(err)
-			return err
+			return g.shutdown(err)
 		case <-a.donec:
+		case <-stoppedc:
+			g.mu.Lock()
+			serr := g.shutdownErr
+			g.mu.Unlock()
+
+			if serr != nil {
+				return serr
+			}
 		}
 	}
 
 	select {
-	case err := <-g.errc:
-		return err
+	case <-g.errc:
+		return g.runError()
 	default:
 		return nil
 	}
 }
 
-func (g *Group) interrupt(err error) {
-	for i := len(g.actors) - 1; i >= 0; i-- {
-		a := g.actors[i]
-		a.interrupt(err)
-		<-a.donec
+// shutdown interrupts all actors with err, and returns the result of Run.
+func (g *Group) shutdown(err error) error {
+	serr := g.interrupt(err)
+	rerr := g.runError()
+	if serr != nil {
+		serr.Err = rerr
+		return serr
 	}
+	return rerr
+}
+
+// runError returns the exits of the group actors.
+func (g *Group) runError() *RunError {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	rerr := &RunError{}
+	for _, a := range g.actors {
+		if a.done {
+			rerr.Exits = append(rerr.Exits, a.exit)
+		}
+	}
+	return rerr
+}
+
+// Stop interrupts all actors in the reverse order they are started, causing
+// Run to return. It is the interrupt func of a group started as an actor.
+func (g *Group) Stop(err error) {
+	g.init()
+	g.interrupt(err)
 }
 
+func (g *Group) init() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.errc == nil {
+		g.errc = make(chan error, 1)
+		g.cond = sync.NewCond(&g.mu)
+		g.stoppedc = make(chan struct{})
+	}
+}
+
+// interrupt interrupts all actors in reverse order, waiting for each to exit
+// within its shutdown timeout. It returns the actors which have not exited.
+func (g *Group) interrupt(err error) *ShutdownError {
+	g.mu.Lock()
+	g.stopping = true
+	actors := append([]*actor(nil), g.actors...)
+	g.mu.Unlock()
+
+	var serr *ShutdownError
+	for i := len(actors) - 1; i >= 0; i-- {
+		a := actors[i]
+
+		g.mu.Lock()
+		if !a.stopped {
+			a.stopped = true
+			close(a.stopc)
+			g.cond.Broadcast()
+		}
+		g.mu.Unlock()
+
+		g.interruptActor(a, err)
+		if !a.wait() {
+			if serr == nil {
+				serr = &ShutdownError{Err: err}
+			}
+			serr.Actors = append(serr.Actors, g.status(a))
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	select {
+	case <-g.stoppedc:
+	default:
+		g.shutdownErr = serr
+		close(g.stoppedc)
+	}
+	return serr
+}
+
+// relaunch launches the exited actors of a group whose Run has returned. It
+// must be called with the group mutex held.
+func (g *Group) relaunch() {
+	select {
+	case <-g.errc:
+	default:
+	}
+
+	g.stopping = false
+	g.triggered = false
+	g.stoppedc = make(chan struct{})
+	g.shutdownErr = nil
+	for _, a := range g.actors {
+		if a.done {
+			a.restarts = restarts{}
+			a.restartCount++
+			g.launch(a)
+		}
+	}
+}
+
+// actor is the state of a started actor, guarded by the group mutex.
 type actor struct {
-	interrupt func(error)
-	donec     chan struct{}
+	Actor
+
+	index    int
+	restarts restarts
+
+	startedAt    time.Time
+	lastErr      error
+	restartCount int
+
+	// probeErr is the error of a failed liveness probe, which replaces the
+	// error of the interrupted execution.
+	probeErr *ProbeError
+
+	// running is set while the execute func runs. interrupted is set once
+	// the interrupt func is called for the running execute func, or its
+	// context is cancelled.
+	running     bool
+	interrupted bool
+	cancel      context.CancelFunc
+
+	// held is set while the actor is restarted by the group strategy, and
+	// must not execute.
+	held bool
+
+	// stopped is set once the group interrupts the actor, which is not
+	// restarted anymore. stopc is closed at the same time.
+	stopped bool
+	stopc   chan struct{}
+
+	done  bool
+	donec chan struct{}
+	exit  Exit
+}
+
+// launch runs the execute func of a. It must be called with the group mutex
+// held.
+func (g *Group) launch(a *actor) {
+	a.held = false
+	a.stopped = false
+	a.stopc = make(chan struct{})
+	a.done = false
+	a.donec = make(chan struct{})
+	a.exit = Exit{}
+
+	go g.run(a, g.begin(a))
+}
+
+// begin starts an execution of a, and returns its context. It must be called
+// with the group mutex held.
+func (g *Group) begin(a *actor) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	a.running = true
+	a.interrupted = false
+	a.cancel = cancel
+	a.startedAt = time.Now()
+	a.probeErr = nil
+
+	if a.Probe.Check != nil {
+		go g.probe(a, ctx)
+	}
+
+	g.emit(a, nil)
+	return ctx
+}
+
+func (a *actor) execute(ctx context.Context) error {
+	if a.ExecuteContext != nil {
+		return a.ExecuteContext(ctx)
+	}
+	return a.Execute()
+}
+
+// wait waits for a to exit within its shutdown timeout, and returns false if
+// it has not.
+func (a *actor) wait() bool {
+	if a.ShutdownTimeout <= 0 {
+		<-a.donec
+		return true
+	}
+
+	t := time.NewTimer(a.ShutdownTimeout)
+	defer t.Stop()
+
+	select {
+	case <-a.donec:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+func (g *Group) run(a *actor, ctx context.Context) {
+	defer g.finish(a)
+
+	for {
+		err := a.execute(ctx)
+
+		backoff, ok, err := g.exited(a, err)
+		if !ok {
+			g.escalate(a, err)
+			return
+		}
+
+		if backoff > 0 {
+			t := time.NewTimer(backoff)
+			select {
+			case <-t.C:
+			case <-a.stopc:
+			}
+			t.Stop()
+		}
+
+		if ctx = g.restart(a, err); ctx == nil {
+			g.escalate(a, nil)
+			return
+		}
+	}
+}
+
+// exited records the return of the execute func of a. It returns whether the
+// actor is restarted and its backoff, or the error escalated to the group.
+func (g *Group) exited(a *actor, err error) (time.Duration, bool, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	a.running = false
+	a.cancel()
+	if a.probeErr != nil {
+		err = a.probeErr
+	}
+	if err != nil {
+		a.lastErr = err
+	}
+	g.cond.Broadcast()
+
+	switch {
+	case a.stopped:
+		return 0, false, err
+	case a.held:
+		// interrupted by the restart of another actor.
+		if a.Restart.Policy == RestartNever {
+			return 0, false, nil
+		}
+		g.emit(a, err)
+		return 0, true, nil
+	case !a.Restart.shouldRestart(err):
+		return 0, false, err
+	}
+
+	backoff, ok := a.restarts.next(a.Restart, time.Now())
+	if !ok {
+		if err == nil {
+			err = ErrMaxRestarts
+		}
+		return 0, false, err
+	}
+
+	g.emit(a, err)
+	return backoff, true, err
+}
+
+// restart applies the group strategy to the restart of a, and waits until a
+// may execute again. It returns the context of the next execution, or nil if
+// the actor was stopped instead.
+func (g *Group) restart(a *actor, err error) context.Context {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !a.stopped && !a.held && g.Strategy != OneForOne {
+		g.restartSiblings(a, err)
+	}
+
+	for a.held && !a.stopped {
+		g.cond.Wait()
+	}
+	if a.stopped {
+		return nil
+	}
+
+	a.restartCount++
+	return g.begin(a)
 }
 
-func (a actor) run(execute func() error, errc chan<- error) {
-	defer close(a.donec)
+// escalate records the last exit of a, and triggers the interruption of the
+// group with a non-nil error, unless already triggered.
+func (g *Group) escalate(a *actor, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 
-	if err := execute(); err != nil {
+	trigger := err != nil && !g.triggered
+	if trigger {
+		g.triggered = true
 		select {
-		case errc <- err:
+		case g.errc <- err:
 		default:
 		}
 	}
+
+	a.exit = Exit{
+		Name:    a.name(),
+		Err:     err,
+		Time:    time.Now(),
+		Trigger: trigger,
+	}
+}
+
+func (g *Group) finish(a *actor) {
+	g.mu.Lock()
+	a.running = false
+	a.done = true
+	g.emit(a, a.exit.Err)
+	g.cond.Broadcast()
+	g.mu.Unlock()
+
+	close(a.donec)
+}
+
+// interruptActor calls the interrupt func of a, or cancels its context, once
+// per execution.
+func (g *Group) interruptActor(a *actor, err error) {
+	g.mu.Lock()
+	interrupt := g.interrupting(a)
+	g.mu.Unlock()
+
+	if interrupt != nil {
+		interrupt(err)
+	}
+}
+
+// interrupting marks the execution of a as interrupted, and returns the func
+// interrupting it, or nil if it already is. It must be called with the group
+// mutex held, and the returned func without.
+func (g *Group) interrupting(a *actor) func(error) {
+	if a.interrupted {
+		return nil
+	}
+	a.interrupted = true
+	if a.running {
+		g.emit(a, nil)
+	}
+
+	if a.ExecuteContext != nil {
+		cancel := a.cancel
+		return func(error) { cancel() }
+	}
+	return a.Interrupt
 }
@@ -1,7 +1,10 @@
 package supervisor
 
 import (
+	"context"
 	"errors"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -31,7 +34,7 @@ func TestGroupOne(t *testing.T) {
 	go func() { res <- g.Run() }()
 	select {
 	case err := <-res:
-		if want, have := myError, err; want != have {
+		if want, have := myError, err; !errors.Is(have, want) {
 			t.Errorf("want %v, have %v", want, have)
 		}
 	case <-time.After(100 * time.Millisecond):
@@ -59,7 +62,7 @@ func TestGroupMany(t *testing.T) {
 
 	select {
 	case err := <-res:
-		if want, have := interrupt, err; want != have {
+		if want, have := interrupt, err; !errors.Is(have, want) {
 			t.Errorf("want %v, have %v", want, have)
 		}
 	case <-time.After(100 * time.Millisecond):
@@ -81,7 +84,7 @@ func TestGroupStartError(t *testing.T) {
 	g.errc <- interrupt
 
 	cancel := make(chan struct{})
-	if err := g.Start(func() error { <-cancel; return nil }, func(error) { close(cancel) }); err != interrupt {
+	if err := g.Start(func() error { <-cancel; return nil }, func(error) { close(cancel) }); !errors.Is(err, interrupt) {
 		t.Fatalf("want err %v, got %v", interrupt, err)
 	}
 }
@@ -115,10 +118,161 @@ func TestGroupInterruptOrder(t *testing.T) {
 
 	select {
 	case err := <-res:
-		if want, have := interrupt, err; want != have {
+		if want, have := interrupt, err; !errors.Is(have, want) {
 			t.Errorf("want %v, have %v", want, have)
 		}
 	case <-time.After(100 * time.Millisecond):
 		t.Errorf("timeout")
 	}
 }
+
+func TestGroupStartContext(t *testing.T) {
+	interrupt := errors.New("interrupt")
+
+	var (
+		mu        sync.Mutex
+		cancelled []int
+	)
+	var g Group
+	for i := 0; i < 3; i++ {
+		i := i
+		err := g.StartContext(func(ctx context.Context) error {
+			<-ctx.Done()
+
+			mu.Lock()
+			cancelled = append(cancelled, i)
+			mu.Unlock()
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Start(func() error { return interrupt }, func(error) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := interrupt, g.Run(); !errors.Is(have, want) {
+		t.Fatalf("want %v, have %v", want, have)
+	}
+	if want, have := []int{2, 1, 0}, cancelled; !reflect.DeepEqual(want, have) {
+		t.Errorf("want cancel order %v, have %v", want, have)
+	}
+}
+
+func TestGroupShutdownTimeout(t *testing.T) {
+	interrupt := errors.New("interrupt")
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	var g Group
+	err := g.StartActor(Actor{
+		Name:            "stuck",
+		ExecuteContext:  func(context.Context) error { <-stuck; return nil },
+		ShutdownTimeout: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel := make(chan struct{})
+	if err := g.Start(func() error { <-cancel; return nil }, func(error) { close(cancel) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(func() error { return interrupt }, func(error) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	res := make(chan error)
+	go func() { res <- g.Run() }()
+
+	select {
+	case err := <-res:
+		serr, ok := err.(*ShutdownError)
+		if !ok {
+			t.Fatalf("want *ShutdownError, have %v", err)
+		}
+		if want, have := 1, len(serr.Actors); want != have {
+			t.Fatalf("want %d actors, have %d", want, have)
+		}
+		if want, have := "stuck", serr.Actors[0].Name; want != have {
+			t.Errorf("want actor %q, have %q", want, have)
+		}
+		if want, have := StateStopping, serr.Actors[0].State; want != have {
+			t.Errorf("want state %s, have %s", want, have)
+		}
+		if !errors.Is(err, interrupt) {
+			t.Errorf("want %v to wrap %v", err, interrupt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestGroupRunError(t *testing.T) {
+	failure := errors.New("failure")
+	drain := errors.New("drain")
+
+	var g Group
+	err := g.StartActor(Actor{
+		Name:      "nat",
+		Execute:   func() error { return failure },
+		Interrupt: func(error) {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel := make(chan struct{})
+	err = g.StartActor(Actor{
+		Name:      "logs",
+		Execute:   func() error { <-cancel; return drain },
+		Interrupt: func(error) { close(cancel) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(func() error { return nil }, func(error) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	err = g.Run()
+
+	rerr, ok := err.(*RunError)
+	if !ok {
+		t.Fatalf("want *RunError, have %v", err)
+	}
+	if want, have := 3, len(rerr.Exits); want != have {
+		t.Fatalf("want %d exits, have %d", want, have)
+	}
+	for i, want := range []Exit{
+		{Name: "nat", Err: failure, Trigger: true},
+		{Name: "logs", Err: drain},
+		{Name: "actor 2"},
+	} {
+		have := rerr.Exits[i]
+		if have.Time.IsZero() {
+			t.Errorf("exit %d: want exit time", i)
+		}
+		have.Time = time.Time{}
+		if want != have {
+			t.Errorf("exit %d: want %+v, have %+v", i, want, have)
+		}
+	}
+
+	if !errors.Is(err, failure) || !errors.Is(err, drain) {
+		t.Errorf("want %v to wrap all actor errors", err)
+	}
+	if want, have := "supervisor: nat: failure (also logs: drain)", err.Error(); want != have {
+		t.Errorf("want error %q, have %q", want, have)
+	}
+
+	var exit exitError
+	if errors.As(err, &exit) {
+		t.Errorf("want no exitError in %v", err)
+	}
+}
+
+type exitError int
+
+func (e exitError) Error() string { return "exit" }
@@ -0,0 +1,121 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrProbeTimeout is the error of a liveness check not returning within the
+// probe timeout.
+var ErrProbeTimeout = errors.New("supervisor: liveness probe timed out")
+
+// Default liveness probe configuration.
+const (
+	DefaultProbeInterval         = 10 * time.Second
+	DefaultProbeTimeout          = time.Second
+	DefaultProbeFailureThreshold = 3
+)
+
+// Probe is the liveness probe of an actor. Check is called every Interval
+// while the actor executes. Once it has failed FailureThreshold consecutive
+// times, the actor is interrupted with a *ProbeError, which is the error of
+// the execution: the actor is restarted or interrupts the group according to
+// its restart policy.
+type Probe struct {
+	// Check returns a non-nil error if the actor is not live. Its context is
+	// cancelled once the Timeout expires, a check not returning by then
+	// fails with ErrProbeTimeout.
+	Check func(ctx context.Context) error
+
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int
+}
+
+// ProbeError is the error of an actor failing its liveness probe.
+type ProbeError struct {
+	// Err is the error of the last check.
+	Err      error
+	Failures int
+}
+
+func (e *ProbeError) Error() string {
+	return fmt.Sprintf("supervisor: liveness probe failed %d times: %v", e.Failures, e.Err)
+}
+
+// Unwrap returns the error of the last check.
+func (e *ProbeError) Unwrap() error { return e.Err }
+
+// probe checks the liveness of a during the execution of ctx.
+func (g *Group) probe(a *actor, ctx context.Context) {
+	p := a.Probe
+	if p.Interval <= 0 {
+		p.Interval = DefaultProbeInterval
+	}
+	if p.Timeout <= 0 {
+		p.Timeout = DefaultProbeTimeout
+	}
+	if p.FailureThreshold <= 0 {
+		p.FailureThreshold = DefaultProbeFailureThreshold
+	}
+
+	t := time.NewTicker(p.Interval)
+	defer t.Stop()
+
+	failures := 0
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+
+		err := p.check(ctx)
+		if err == nil {
+			failures = 0
+			continue
+		}
+		if failures++; failures < p.FailureThreshold {
+			continue
+		}
+
+		perr := &ProbeError{Err: err, Failures: failures}
+
+		// the execution may have exited, and the actor restarted, since the
+		// check: only the execution of ctx is interrupted.
+		var interrupt func(error)
+		g.mu.Lock()
+		if ctx.Err() == nil {
+			a.probeErr = perr
+			interrupt = g.interrupting(a)
+		}
+		g.mu.Unlock()
+
+		if interrupt != nil {
+			interrupt(perr)
+		}
+		return
+	}
+}
+
+// check runs a single check, without waiting longer than the timeout for a
+// wedged check to return.
+func (p Probe) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	errc := make(chan error, 1)
+	go func() { errc <- p.Check(ctx) }()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return ErrProbeTimeout
+		}
+		return ctx.Err()
+	}
+}
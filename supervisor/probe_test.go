@@ -0,0 +1,94 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProbeRestart(t *testing.T) {
+	unhealthy := errors.New("unhealthy")
+
+	var (
+		log    testLog
+		startc = make(chan string, 2)
+		eventc = make(chan Event, 16)
+		checks int32
+		g      Group
+	)
+	g.Notify(eventc)
+
+	a := newTestActor("nat", startc, &log)
+	act := a.actor(RestartOnFailure)
+	act.Name = "nat"
+	act.Probe = Probe{
+		Check: func(context.Context) error {
+			if atomic.AddInt32(&checks, 1) <= 2 {
+				return unhealthy
+			}
+			return nil
+		},
+		Interval:         time.Millisecond,
+		FailureThreshold: 2,
+	}
+	if err := g.StartActor(act); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, eventc, "nat", StateRunning)
+	waitEvent(t, eventc, "nat", StateStopping)
+
+	e := waitEvent(t, eventc, "nat", StateRestarting)
+	var perr *ProbeError
+	if !errors.As(e.Err, &perr) {
+		t.Fatalf("want *ProbeError, have %v", e.Err)
+	}
+	if want, have := 2, perr.Failures; want != have {
+		t.Errorf("want %d failures, have %d", want, have)
+	}
+	if !errors.Is(e.Err, unhealthy) {
+		t.Errorf("want %v to wrap %v", e.Err, unhealthy)
+	}
+	waitEvent(t, eventc, "nat", StateRunning)
+
+	g.Stop(nil)
+	if err := g.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	wedged := make(chan struct{})
+	defer close(wedged)
+
+	var (
+		log    testLog
+		startc = make(chan string, 1)
+		g      Group
+	)
+
+	a := newTestActor("forwarder", startc, &log)
+	act := a.actor(RestartNever)
+	act.Probe = Probe{
+		Check:            func(context.Context) error { <-wedged; return nil },
+		Interval:         time.Millisecond,
+		Timeout:          5 * time.Millisecond,
+		FailureThreshold: 1,
+	}
+	if err := g.StartActor(act); err != nil {
+		t.Fatal(err)
+	}
+
+	res := make(chan error)
+	go func() { res <- g.Run() }()
+
+	select {
+	case err := <-res:
+		if !errors.Is(err, ErrProbeTimeout) {
+			t.Errorf("want %v, have %v", ErrProbeTimeout, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,101 @@
+package supervisor
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrMaxRestarts is escalated to the group by an actor restarted more than
+// its MaxRestarts without an error.
+var ErrMaxRestarts = errors.New("supervisor: max restarts exceeded")
+
+// Default restart backoffs.
+const (
+	DefaultBackoff    = 100 * time.Millisecond
+	DefaultMaxBackoff = 10 * time.Second
+)
+
+// RestartPolicy determines when an actor is restarted after its execute func
+// returns.
+type RestartPolicy int
+
+// Restart policies.
+const (
+	// RestartNever does not restart the actor, a non-nil error interrupts
+	// the group.
+	RestartNever RestartPolicy = iota
+
+	// RestartOnFailure restarts the actor when its execute func returns a
+	// non-nil error.
+	RestartOnFailure
+
+	// RestartAlways restarts the actor whenever its execute func returns.
+	RestartAlways
+)
+
+// Restart configures the restarts of an actor. Restarts are delayed by an
+// exponential backoff, starting at Backoff and doubling with each restart
+// within the Window, up to MaxBackoff.
+//
+// When the actor would restart more than MaxRestarts times within the
+// Window, the error is escalated to the group instead, interrupting all
+// actors. A zero MaxRestarts allows unlimited restarts, a zero Window counts
+// every restart.
+type Restart struct {
+	Policy RestartPolicy
+
+	Backoff, MaxBackoff time.Duration
+
+	MaxRestarts int
+	Window      time.Duration
+}
+
+func (r Restart) shouldRestart(err error) bool {
+	switch r.Policy {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// restarts are the recent restarts of an actor.
+type restarts struct {
+	times []time.Time
+}
+
+// next records a restart at now, and returns its backoff. It returns false
+// if the restart budget of r is exhausted.
+func (rs *restarts) next(r Restart, now time.Time) (time.Duration, bool) {
+	if r.Backoff <= 0 {
+		r.Backoff = DefaultBackoff
+	}
+	if r.MaxBackoff <= 0 {
+		r.MaxBackoff = DefaultMaxBackoff
+	}
+
+	if r.Window > 0 {
+		i := 0
+		for i < len(rs.times) && now.Sub(rs.times[i]) >= r.Window {
+			i++
+		}
+		rs.times = rs.times[i:]
+	}
+
+	if r.MaxRestarts > 0 && len(rs.times) >= r.MaxRestarts {
+		return 0, false
+	}
+
+	backoff := r.Backoff
+	for i := 0; i < len(rs.times) && backoff < r.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > r.MaxBackoff {
+		backoff = r.MaxBackoff
+	}
+
+	rs.times = append(rs.times, now)
+	return backoff, true
+}
@@ -0,0 +1,187 @@
+package supervisor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRestartOnFailure(t *testing.T) {
+	failure := errors.New("failure")
+
+	var (
+		runs  int
+		donec = make(chan struct{})
+	)
+	execute := func() error {
+		if runs++; runs < 3 {
+			return failure
+		}
+		<-donec
+		return nil
+	}
+
+	var g Group
+	err := g.StartActor(Actor{
+		Execute:   execute,
+		Interrupt: func(error) { close(donec) },
+		Restart: Restart{
+			Policy:  RestartOnFailure,
+			Backoff: time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := errors.New("stop")
+	if err := g.Start(func() error { time.Sleep(50 * time.Millisecond); return stop }, func(error) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := stop, g.Run(); !errors.Is(got, want) {
+		t.Fatalf("want error %v, got %v", want, got)
+	}
+	if want, got := 3, runs; want != got {
+		t.Errorf("want %d runs, got %d", want, got)
+	}
+}
+
+func TestRestartAlways(t *testing.T) {
+	runc := make(chan struct{}, 3)
+	execute := func() error {
+		runc <- struct{}{}
+		return nil
+	}
+
+	var g Group
+	err := g.StartActor(Actor{
+		Execute:   execute,
+		Interrupt: func(error) {},
+		Restart: Restart{
+			Policy:      RestartAlways,
+			Backoff:     time.Millisecond,
+			MaxRestarts: 2,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := ErrMaxRestarts, g.Run(); !errors.Is(got, want) {
+		t.Fatalf("want error %v, got %v", want, got)
+	}
+	if want, got := 3, len(runc); want != got {
+		t.Errorf("want %d runs, got %d", want, got)
+	}
+}
+
+func TestRestartEscalation(t *testing.T) {
+	failure := errors.New("failure")
+
+	var runs int
+	var g Group
+	err := g.StartActor(Actor{
+		Execute:   func() error { runs++; return failure },
+		Interrupt: func(error) {},
+		Restart: Restart{
+			Policy:      RestartOnFailure,
+			Backoff:     time.Millisecond,
+			MaxRestarts: 2,
+			Window:      time.Minute,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var interrupted error
+	cancel := make(chan struct{})
+	if err := g.Start(func() error { <-cancel; return nil }, func(err error) { interrupted = err; close(cancel) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, got := failure, g.Run(); !errors.Is(got, want) {
+		t.Fatalf("want error %v, got %v", want, got)
+	}
+	if want, got := 3, runs; want != got {
+		t.Errorf("want %d runs, got %d", want, got)
+	}
+	if want, got := failure, interrupted; want != got {
+		t.Errorf("want interrupt error %v, got %v", want, got)
+	}
+}
+
+func TestRestartInterrupt(t *testing.T) {
+	failure := errors.New("failure")
+
+	runc := make(chan struct{}, 1)
+	var g Group
+	err := g.StartActor(Actor{
+		Execute:   func() error { runc <- struct{}{}; return failure },
+		Interrupt: func(error) {},
+		Restart: Restart{
+			Policy:  RestartOnFailure,
+			Backoff: time.Hour,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-runc
+
+	stop := errors.New("stop")
+	if err := g.Start(func() error { return stop }, func(error) {}); err != nil {
+		t.Fatal(err)
+	}
+
+	res := make(chan error)
+	go func() { res <- g.Run() }()
+
+	select {
+	case err := <-res:
+		if want, got := stop, err; !errors.Is(got, want) {
+			t.Errorf("want error %v, got %v", want, got)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("timeout: backoff was not interrupted")
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	r := Restart{
+		Policy:      RestartOnFailure,
+		Backoff:     time.Second,
+		MaxBackoff:  5 * time.Second,
+		MaxRestarts: 5,
+		Window:      time.Minute,
+	}
+	var rs restarts
+
+	now := time.Now()
+	tests := []struct {
+		at   time.Duration
+		want time.Duration
+		ok   bool
+	}{
+		{0, time.Second, true},
+		{time.Second, 2 * time.Second, true},
+		{2 * time.Second, 4 * time.Second, true},
+		{3 * time.Second, 5 * time.Second, true},
+		{4 * time.Second, 5 * time.Second, true},
+		{5 * time.Second, 0, false},
+		// the first restarts leave the window.
+		{61 * time.Second, 5 * time.Second, true},
+		{10 * time.Minute, time.Second, true},
+	}
+
+	for _, test := range tests {
+		backoff, ok := rs.next(r, now.Add(test.at))
+		if want, got := test.ok, ok; want != got {
+			t.Fatalf("at %s: want ok %t, got %t", test.at, want, got)
+		}
+		if want, got := test.want, backoff; want != got {
+			t.Errorf("at %s: want backoff %s, got %s", test.at, want, got)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package supervisor
+
+import (
+	"fmt"
+	"time"
+)
+
+// State is the lifecycle state of an actor.
+type State int
+
+// Actor states.
+const (
+	// StateRunning is an actor whose execute func is running.
+	StateRunning State = iota
+
+	// StateRestarting is an actor waiting for its restart.
+	StateRestarting
+
+	// StateStopping is an interrupted actor whose execute func is still
+	// running.
+	StateStopping
+
+	// StateExited is an actor which is not restarted anymore.
+	StateExited
+)
+
+func (s State) String() string {
+	switch s {
+	case StateRunning:
+		return "running"
+	case StateRestarting:
+		return "restarting"
+	case StateStopping:
+		return "stopping"
+	case StateExited:
+		return "exited"
+	default:
+		return "unknown"
+	}
+}
+
+// ActorStatus is the status of an actor of a group.
+type ActorStatus struct {
+	Name  string
+	State State
+
+	// StartedAt is the start time of the last execution.
+	StartedAt time.Time
+
+	// LastError is the last non-nil error returned by the actor.
+	LastError error
+
+	// Restarts counts the restarts of the actor.
+	Restarts int
+}
+
+// Status returns the status of the actors of the group, in start order.
+func (g *Group) Status() []ActorStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	status := make([]ActorStatus, 0, len(g.actors))
+	for _, a := range g.actors {
+		status = append(status, a.status())
+	}
+	return status
+}
+
+// status returns the status of a.
+func (g *Group) status(a *actor) ActorStatus {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return a.status()
+}
+
+// status returns the status of a. It must be called with the group mutex
+// held.
+func (a *actor) status() ActorStatus {
+	return ActorStatus{
+		Name:      a.name(),
+		State:     a.state(),
+		StartedAt: a.startedAt,
+		LastError: a.lastErr,
+		Restarts:  a.restartCount,
+	}
+}
+
+func (a *actor) name() string {
+	if a.Name != "" {
+		return a.Name
+	}
+	return fmt.Sprintf("actor %d", a.index)
+}
+
+func (a *actor) state() State {
+	switch {
+	case a.done:
+		return StateExited
+	case a.running && (a.interrupted || a.stopped):
+		return StateStopping
+	case a.running:
+		return StateRunning
+	case a.stopped:
+		return StateStopping
+	default:
+		return StateRestarting
+	}
+}
+
+// Event is the transition of an actor to State. Err is the error returned by
+// the actor, for restarting and exited events.
+type Event struct {
+	Name  string
+	State State
+	Err   error
+	Time  time.Time
+}
+
+// Notify causes the group to relay actor events to c. The group does not
+// block sending to c: the caller must ensure that c has sufficient buffer
+// space to keep up with the expected event rate.
+func (g *Group) Notify(c chan<- Event) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.notify = append(g.notify, c)
+}
+
+// StopNotify causes the group to stop relaying events to c.
+func (g *Group) StopNotify(c chan<- Event) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, n := range g.notify {
+		if n == c {
+			g.notify = append(g.notify[:i], g.notify[i+1:]...)
+			return
+		}
+	}
+}
+
+// emit relays the current state of a to the notified channels. It must be
+// called with the group mutex held.
+func (g *Group) emit(a *actor, err error) {
+	if len(g.notify) == 0 {
+		return
+	}
+
+	e := Event{
+		Name:  a.name(),
+		State: a.state(),
+		Err:   err,
+		Time:  time.Now(),
+	}
+	for _, c := range g.notify {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package supervisor
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGroupStatus(t *testing.T) {
+	failure := errors.New("failure")
+
+	var (
+		log    testLog
+		startc = make(chan string, 2)
+		g      Group
+	)
+
+	a := newTestActor("nat", startc, &log)
+	act := a.actor(RestartOnFailure)
+	act.Name = "nat"
+	if err := g.StartActor(act); err != nil {
+		t.Fatal(err)
+	}
+	receive(t, startc, 1)
+
+	a.failc <- failure
+	receive(t, startc, 1)
+
+	status := g.Status()
+	if want, have := 1, len(status); want != have {
+		t.Fatalf("want %d actors, have %d", want, have)
+	}
+	if status[0].StartedAt.IsZero() {
+		t.Error("want start time")
+	}
+	status[0].StartedAt = time.Time{}
+
+	want := ActorStatus{
+		Name:      "nat",
+		State:     StateRunning,
+		LastError: failure,
+		Restarts:  1,
+	}
+	if have := status[0]; want != have {
+		t.Errorf("want status %+v, have %+v", want, have)
+	}
+
+	g.Stop(nil)
+	if want, have := StateExited, g.Status()[0].State; want != have {
+		t.Errorf("want state %s, have %s", want, have)
+	}
+}
+
+func TestGroupNotify(t *testing.T) {
+	failure := errors.New("failure")
+
+	var (
+		log    testLog
+		startc = make(chan string, 2)
+		eventc = make(chan Event, 16)
+		g      Group
+	)
+	g.Notify(eventc)
+
+	a := newTestActor("nat", startc, &log)
+	act := a.actor(RestartOnFailure)
+	act.Name = "nat"
+	if err := g.StartActor(act); err != nil {
+		t.Fatal(err)
+	}
+	waitEvent(t, eventc, "nat", StateRunning)
+
+	a.failc <- failure
+	if e := waitEvent(t, eventc, "nat", StateRestarting); e.Err != failure {
+		t.Errorf("want restart error %v, have %v", failure, e.Err)
+	}
+	waitEvent(t, eventc, "nat", StateRunning)
+
+	g.Stop(nil)
+	waitEvent(t, eventc, "nat", StateStopping)
+	waitEvent(t, eventc, "nat", StateExited)
+
+	g.StopNotify(eventc)
+	if err := g.Run(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case e := <-eventc:
+		t.Errorf("want no event after StopNotify, have %s %s", e.Name, e.State)
+	default:
+	}
+}
+
+// waitEvent returns the next event of c, which must be the transition of
+// name to state.
+func waitEvent(t *testing.T, c <-chan Event, name string, state State) Event {
+	t.Helper()
+
+	select {
+	case e := <-c:
+		if e.Name != name || e.State != state {
+			t.Fatalf("want event %s %s, have %s %s", name, state, e.Name, e.State)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("want event time")
+		}
+		return e
+	case <-time.After(time.Second):
+		t.Fatalf("timeout: want event %s %s", name, state)
+		return Event{}
+	}
+}
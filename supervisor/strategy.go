@@ -0,0 +1,93 @@
+package supervisor
+
+// Strategy determines the actors of a group restarted along with an actor
+// restarted by its restart policy, after its backoff. Restarted siblings are
+// interrupted in the reverse order they are started, with the error of the
+// restarted actor, and launched again in start order. Siblings without a
+// restart policy, and those which have already exited, are not restarted.
+type Strategy int
+
+// Supervision strategies.
+const (
+	// OneForOne restarts only the restarted actor.
+	OneForOne Strategy = iota
+
+	// OneForAll restarts all actors of the group.
+	OneForAll
+
+	// RestForOne restarts the actors started after the restarted actor.
+	RestForOne
+)
+
+func (s Strategy) String() string {
+	switch s {
+	case OneForOne:
+		return "one-for-one"
+	case OneForAll:
+		return "one-for-all"
+	case RestForOne:
+		return "rest-for-one"
+	default:
+		return "unknown"
+	}
+}
+
+// siblings returns the actors restarted with a, in start order.
+func (g *Group) siblings(a *actor) []*actor {
+	var siblings []*actor
+	after := false
+	for _, s := range g.actors {
+		switch {
+		case s == a:
+			after = true
+		case s.done:
+		case g.Strategy == OneForAll, g.Strategy == RestForOne && after:
+			siblings = append(siblings, s)
+		}
+	}
+	return siblings
+}
+
+// restartSiblings restarts the siblings of a according to the group strategy.
+// It must be called with the group mutex held, which is released while the
+// siblings are interrupted.
+func (g *Group) restartSiblings(a *actor, err error) {
+	for g.restarting && !a.held && !a.stopped {
+		g.cond.Wait()
+	}
+	if a.held || a.stopped || g.stopping {
+		// restarted by another actor, or the group is stopping.
+		return
+	}
+
+	g.restarting = true
+	defer func() {
+		g.restarting = false
+		g.cond.Broadcast()
+	}()
+
+	siblings := g.siblings(a)
+	for i := len(siblings) - 1; i >= 0; i-- {
+		s := siblings[i]
+		if s.stopped {
+			continue
+		}
+
+		s.held = true
+		if !s.running {
+			continue
+		}
+
+		g.mu.Unlock()
+		g.interruptActor(s, err)
+		g.mu.Lock()
+
+		for s.running && !s.stopped && !a.stopped {
+			g.cond.Wait()
+		}
+	}
+
+	for _, s := range siblings {
+		s.held = false
+	}
+}
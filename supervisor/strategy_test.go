@@ -0,0 +1,197 @@
+package supervisor
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupStrategy(t *testing.T) {
+	failure := errors.New("failure")
+
+	tests := []struct {
+		strategy    Strategy
+		restarted   []string
+		interrupted []string
+	}{
+		{OneForOne, []string{"b"}, nil},
+		{OneForAll, []string{"a", "b", "c"}, []string{"c", "a"}},
+		{RestForOne, []string{"b", "c"}, []string{"c"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.strategy.String(), func(t *testing.T) {
+			var (
+				log    testLog
+				startc = make(chan string, 3)
+				g      = Group{Strategy: test.strategy}
+			)
+
+			actors := map[string]*testActor{}
+			for _, name := range []string{"a", "b", "c"} {
+				a := newTestActor(name, startc, &log)
+				actors[name] = a
+
+				if err := g.StartActor(a.actor(RestartAlways)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			receive(t, startc, 3)
+
+			actors["b"].failc <- failure
+
+			if want, got := test.restarted, receive(t, startc, len(test.restarted)); !reflect.DeepEqual(want, got) {
+				t.Errorf("want restarted actors %v, got %v", want, got)
+			}
+			if want, got := test.interrupted, log.get(); !reflect.DeepEqual(want, got) {
+				t.Errorf("want interrupted actors %v, got %v", want, got)
+			}
+
+			g.Stop(nil)
+			if err := g.Run(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestGroupNested(t *testing.T) {
+	failure := errors.New("failure")
+
+	var (
+		log    testLog
+		startc = make(chan string, 2)
+		child  Group
+	)
+
+	a, b := newTestActor("a", startc, &log), newTestActor("b", startc, &log)
+	if err := child.StartActor(a.actor(RestartNever)); err != nil {
+		t.Fatal(err)
+	}
+	if err := child.StartActor(b.actor(RestartNever)); err != nil {
+		t.Fatal(err)
+	}
+
+	var parent Group
+	err := parent.StartActor(Actor{
+		Execute:   child.Run,
+		Interrupt: child.Stop,
+		Restart: Restart{
+			Policy:  RestartOnFailure,
+			Backoff: time.Millisecond,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, startc, 2)
+
+	a.failc <- failure
+
+	if want, got := []string{"a", "b"}, receive(t, startc, 2); !reflect.DeepEqual(want, got) {
+		t.Errorf("want restarted actors %v, got %v", want, got)
+	}
+	if want, got := []string{"b", "a"}, log.get(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want interrupted actors %v, got %v", want, got)
+	}
+
+	parent.Stop(nil)
+	if err := parent.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testActor runs until it is interrupted, or fails with the error sent on
+// failc.
+type testActor struct {
+	name   string
+	startc chan<- string
+	log    *testLog
+
+	failc chan error
+	stopc chan struct{}
+}
+
+func newTestActor(name string, startc chan<- string, log *testLog) *testActor {
+	return &testActor{
+		name:   name,
+		startc: startc,
+		log:    log,
+		failc:  make(chan error),
+		stopc:  make(chan struct{}, 1),
+	}
+}
+
+func (a *testActor) actor(policy RestartPolicy) Actor {
+	return Actor{
+		Execute:   a.execute,
+		Interrupt: a.interrupt,
+		Restart: Restart{
+			Policy:  policy,
+			Backoff: time.Millisecond,
+		},
+	}
+}
+
+func (a *testActor) execute() error {
+	select {
+	case <-a.stopc:
+	default:
+	}
+	a.startc <- a.name
+
+	select {
+	case err := <-a.failc:
+		return err
+	case <-a.stopc:
+		return nil
+	}
+}
+
+func (a *testActor) interrupt(error) {
+	a.log.add(a.name)
+
+	select {
+	case a.stopc <- struct{}{}:
+	default:
+	}
+}
+
+type testLog struct {
+	mu      sync.Mutex
+	entries []string
+}
+
+func (l *testLog) add(entry string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+}
+
+func (l *testLog) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]string(nil), l.entries...)
+}
+
+// receive returns the next n values of c, sorted.
+func receive(t *testing.T, c <-chan string, n int) []string {
+	t.Helper()
+
+	var values []string
+	for len(values) < n {
+		select {
+		case v := <-c:
+			values = append(values, v)
+		case <-time.After(time.Second):
+			t.Fatalf("timeout: received %v", values)
+		}
+	}
+	sort.Strings(values)
+	return values
+}